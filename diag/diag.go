@@ -0,0 +1,183 @@
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"leoscript/token"
+	"sort"
+	"strings"
+)
+
+//go:generate go run golang.org/x/tools/cmd/stringer -type=Severity
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+// Code identifies the kind of problem that a diagnostic reports.
+type Code string
+
+const (
+	CodeInvalidCharacter Code = "invalid-character"
+	CodeSyntax           Code = "syntax"
+	CodeTypeMismatch     Code = "type-mismatch"
+	CodeUndeclared       Code = "undeclared"
+	CodeRedeclared       Code = "redeclared"
+	CodeOutsideLoop      Code = "outside-loop"
+	CodeArgumentCount    Code = "argument-count"
+	CodeMissingReturn    Code = "missing-return"
+	CodeInitOrder        Code = "init-order"
+	CodeInitCycle        Code = "init-cycle"
+	CodeNotConstant      Code = "not-constant"
+	CodeConstAssign      Code = "const-assign"
+	CodeDivisionByZero   Code = "division-by-zero"
+	CodeShadowed         Code = "shadowed"
+	CodeUnknown          Code = "unknown"
+)
+
+// Related is an extra location attached to a diagnostic, like the previous declaration of a redeclared name.
+type Related struct {
+	Span    token.Span
+	Message string
+}
+
+// Diagnostic is a single problem found in a source file.
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string
+	Span     token.Span
+	Related  []Related
+}
+
+// Errorf creates an error diagnostic located at the given span.
+func Errorf(code Code, span token.Span, format string, args ...any) Diagnostic {
+	return Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Span:     span,
+	}
+}
+
+// Warningf creates a warning diagnostic located at the given span.
+func Warningf(code Code, span token.Span, format string, args ...any) Diagnostic {
+	d := Errorf(code, span, format, args...)
+	d.Severity = Warning
+	return d
+}
+
+// WithNote returns a copy of the diagnostic with a related location attached.
+func (d Diagnostic) WithNote(span token.Span, format string, args ...any) Diagnostic {
+	d.Related = append(d.Related[:len(d.Related):len(d.Related)], Related{
+		Span:    span,
+		Message: fmt.Sprintf(format, args...),
+	})
+	return d
+}
+
+func (d Diagnostic) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString(d.Span.Start.String())
+	sb.WriteString(": ")
+
+	if d.Severity != Error {
+		sb.WriteString(strings.ToLower(d.Severity.String()))
+		sb.WriteString(": ")
+	}
+
+	sb.WriteString(d.Message)
+
+	for _, r := range d.Related {
+		fmt.Fprintf(&sb, "\n\t%v: note: %s", r.Span.Start, r.Message)
+	}
+
+	return sb.String()
+}
+
+// Diagnostics is a list of problems found in a source file.
+// It implements error so that all problems can be returned at once.
+type Diagnostics []Diagnostic
+
+// Add appends diagnostics to the list.
+func (ds *Diagnostics) Add(d ...Diagnostic) {
+	*ds = append(*ds, d...)
+}
+
+// AddError appends the diagnostics held by err.
+// Errors that are not diagnostics are added as errors without a position.
+func (ds *Diagnostics) AddError(err error) {
+	if err == nil {
+		return
+	}
+
+	var list Diagnostics
+	if errors.As(err, &list) {
+		ds.Add(list...)
+		return
+	}
+
+	var d Diagnostic
+	if errors.As(err, &d) {
+		ds.Add(d)
+		return
+	}
+
+	ds.Add(Diagnostic{Severity: Error, Code: CodeUnknown, Message: err.Error()})
+}
+
+// HasErrors reports whether any of the diagnostics has the Error severity.
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == Error {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Warnings returns the diagnostics that have the Warning severity.
+func (ds Diagnostics) Warnings() Diagnostics {
+	var warnings Diagnostics
+	for _, d := range ds {
+		if d.Severity == Warning {
+			warnings = append(warnings, d)
+		}
+	}
+
+	return warnings
+}
+
+// Err returns the diagnostics as an error if there are any errors among them, otherwise nil.
+func (ds Diagnostics) Err() error {
+	if !ds.HasErrors() {
+		return nil
+	}
+
+	return ds
+}
+
+// Sort orders the diagnostics by their position in the source.
+func (ds Diagnostics) Sort() {
+	sort.SliceStable(ds, func(i, j int) bool {
+		a, b := ds[i].Span.Start, ds[j].Span.Start
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Offset < b.Offset
+	})
+}
+
+func (ds Diagnostics) Error() string {
+	lines := make([]string, 0, len(ds))
+	for _, d := range ds {
+		lines = append(lines, d.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,124 @@
+package lexer
+
+import (
+	"io"
+	"leoscript/token"
+	"unicode/utf8"
+)
+
+// chunkSize is the number of bytes read from the input at a time.
+const chunkSize = 4096
+
+// fill reads from the input until the buffer holds the byte at offset or the input is exhausted.
+// It reports whether the byte at offset is available.
+func (lx *Lexer) fill(offset int) bool {
+	for offset >= lx.base+len(lx.buf) && !lx.eof {
+		lx.read()
+	}
+
+	return offset < lx.base+len(lx.buf)
+}
+
+func (lx *Lexer) read() {
+	if cap(lx.buf)-len(lx.buf) < chunkSize {
+		buf := make([]byte, len(lx.buf), 2*cap(lx.buf)+chunkSize)
+		copy(buf, lx.buf)
+		lx.buf = buf
+	}
+
+	n, err := lx.r.Read(lx.buf[len(lx.buf):cap(lx.buf)])
+	lx.buf = lx.buf[:len(lx.buf)+n]
+
+	if err != nil {
+		if err != io.EOF {
+			lx.readErr = err
+		}
+		lx.eof = true
+	}
+}
+
+// discard drops the buffered input before the start of the current token, which is no longer needed.
+// The buffer is only compacted once a chunk can be dropped, to avoid moving the input for every token.
+func (lx *Lexer) discard() {
+	n := lx.start - lx.base
+	if n < chunkSize {
+		return
+	}
+
+	lx.buf = lx.buf[:copy(lx.buf, lx.buf[n:])]
+	lx.base = lx.start
+}
+
+// text returns the input between two offsets, which must have been read already.
+func (lx *Lexer) text(from, to int) string {
+	return string(lx.buf[from-lx.base : to-lx.base])
+}
+
+// at returns the character starting at the given offset, or 0 if it is past the end of the input.
+func (lx *Lexer) at(offset int) rune {
+	if !lx.fill(offset+utf8.UTFMax-1) && offset >= lx.base+len(lx.buf) {
+		return 0
+	}
+
+	char, _ := utf8.DecodeRune(lx.buf[offset-lx.base:])
+	return char
+}
+
+// next moves to the next character and returns it, or 0 at the end of the input.
+func (lx *Lexer) next() rune {
+	lx.pos = lx.end()
+	return lx.peek()
+}
+
+// putBack moves back to the previous character.
+func (lx *Lexer) putBack() {
+	if lx.pos > lx.base+len(lx.buf) {
+		lx.pos--
+		return
+	}
+
+	_, size := utf8.DecodeLastRune(lx.buf[:lx.pos-lx.base])
+	lx.pos -= size
+}
+
+// end returns the offset just past the current character.
+func (lx *Lexer) end() int {
+	if !lx.fill(lx.pos) {
+		return lx.pos + 1
+	}
+
+	lx.fill(lx.pos + utf8.UTFMax - 1)
+	_, size := utf8.DecodeRune(lx.buf[lx.pos-lx.base:])
+	return lx.pos + size
+}
+
+func (lx *Lexer) peek() rune {
+	return lx.at(lx.pos)
+}
+
+// position returns the line and column of an offset at or after the start of the current token.
+// It is counted from the position of the token start since the input before it may have been discarded.
+// The column counts characters, not bytes.
+func (lx *Lexer) position(offset int) token.Position {
+	pos := lx.startPos
+
+	for i := lx.start; i < offset; {
+		if i >= lx.base+len(lx.buf) {
+			// Past the end of the input
+			pos.Column += offset - i
+			break
+		}
+
+		char, size := utf8.DecodeRune(lx.buf[i-lx.base:])
+		if char == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+		i += size
+	}
+
+	pos.Offset = offset
+	return pos
+}
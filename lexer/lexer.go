@@ -1,57 +1,131 @@
 package lexer
 
 import (
-	"fmt"
+	"io"
+	"leoscript/diag"
 	"leoscript/token"
-	"leoscript/types"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-var keywords = map[string]token.Token{
-	"true":   token.Boolean{Value: true},
-	"false":  token.Boolean{Value: false},
-	"var":    token.VarDecl{},
-	"int":    token.Type{Kind: types.Int},
-	"bool":   token.Type{Kind: types.Bool},
-	"fn":     token.FnDef{},
-	"return": token.Return{},
-	// "if":       token.If{},
-	// "else":     token.Else{},
-	// "return":   token.Return{},
-	// "while":    token.While{},
-	// "for":      token.For{},
-	//"in": token.In{},
-	// "break":    token.Break{},
-	// "continue": token.Continue{},
+// Lexer reads tokens from an io.Reader one at a time.
+// The input is read as the tokens are requested, so that the source text does not have to be held in memory.
+// Whether the tokens are is up to the consumer, see parser.NewStreamParser.
+type Lexer struct {
+	file string
+	r    io.Reader
+	// eof is set once the reader is exhausted, readErr holds the error that ended it if it was not io.EOF.
+	eof     bool
+	readErr error
+
+	// buf holds the input from offset base onwards, the input before it has been discarded.
+	buf  []byte
+	base int
+
+	// pos is the offset of the first byte of the current character.
+	pos int
+	// start is the offset of the first character of the token currently being lexed.
+	start int
+	// startPos is the position of start, the positions of the rest of the token are counted from it.
+	startPos token.Position
+	// lastLine is the line of the last token, used to tell comments following code from doc comments.
+	lastLine int
+
+	// queue holds the tokens that have been lexed but not yet returned by NextToken.
+	queue []token.Token
+	diags diag.Diagnostics
+
+	// doc holds the comments read since the last token, to be attached to a following fn keyword.
+	doc []string
+	// docEnd is the line the last comment in doc ended on.
+	docEnd int
 }
 
-type lexer struct {
-	input string
-	pos   int
+// New returns a lexer reading from r.
+func New(r io.Reader) *Lexer {
+	return NewFile("", r)
+}
+
+// NewFile works like New but records the file name in the position of every token.
+func NewFile(file string, r io.Reader) *Lexer {
+	return &Lexer{
+		file:     file,
+		r:        r,
+		startPos: token.Position{File: file, Line: 1, Column: 1},
+	}
+}
 
-	tokens []token.Token
+// NextToken returns the next token of the input, or token.EOF at the end of it.
+// Invalid input is skipped and reported by Err once all tokens have been read.
+func (lx *Lexer) NextToken() token.Token {
+	tk := lx.Peek(0)
+	lx.queue = lx.queue[1:]
+	return tk
 }
 
-func (lx *lexer) next() byte {
-	lx.pos++
+// Peek returns the token n tokens ahead without consuming it, Peek(0) is the token returned by the next call to NextToken.
+func (lx *Lexer) Peek(n int) token.Token {
+	for len(lx.queue) <= n {
+		lx.lexToken()
+	}
+
+	return lx.queue[n]
+}
 
-	if lx.pos >= len(lx.input) {
-		return 0
+// Err returns the error that stopped the reader, or the problems found in the input as diag.Diagnostics.
+func (lx *Lexer) Err() error {
+	if lx.readErr != nil {
+		return lx.readErr
 	}
-	char := lx.input[lx.pos]
-	return char
+
+	return lx.diags.Err()
 }
 
-func (lx *lexer) putBack() {
-	lx.pos--
+// Diagnostics returns all problems found in the input so far.
+func (lx *Lexer) Diagnostics() diag.Diagnostics {
+	return lx.diags
 }
 
-func (lx *lexer) peek() byte {
-	return lx.input[lx.pos]
+// errorf reports an error spanning the token currently being lexed.
+func (lx *Lexer) errorf(format string, args ...any) {
+	lx.errorFrom(lx.start, format, args...)
+}
+
+// errorFrom reports an error spanning from the given offset up to and including the current character.
+func (lx *Lexer) errorFrom(offset int, format string, args ...any) {
+	span := token.Span{
+		Start: lx.position(offset),
+		End:   lx.position(lx.end()),
+	}
+
+	lx.diags.Add(diag.Errorf(diag.CodeInvalidCharacter, span, format, args...))
+}
+
+// pushToken adds a token spanning from the start of the current token up to and including the current character.
+// A fn keyword gets the comments on the lines directly above it as its doc comment.
+func (lx *Lexer) pushToken(tk token.Token) {
+	span := token.Span{
+		Start: lx.startPos,
+		End:   lx.position(lx.end()),
+	}
+
+	if fn, ok := tk.(token.FnDef); ok && len(lx.doc) > 0 && lx.docEnd == span.Start.Line-1 {
+		fn.Doc = strings.Join(lx.doc, "\n")
+		tk = fn
+	}
+	lx.doc = nil
+	lx.lastLine = span.Start.Line
+
+	lx.queue = append(lx.queue, tk.WithSpan(span))
 }
 
-func (lx *lexer) pushToken(tk token.Token) {
-	lx.tokens = append(lx.tokens, tk)
+// startToken marks the current character as the start of a new token.
+func (lx *Lexer) startToken() {
+	lx.startPos = lx.position(lx.pos)
+	lx.start = lx.pos
+	lx.discard()
 }
 
 func MustTokenize(input string) []token.Token {
@@ -64,130 +138,448 @@ func MustTokenize(input string) []token.Token {
 }
 
 func Tokenize(input string) ([]token.Token, error) {
-	lx := lexer{input: input}
+	return TokenizeFile("", input)
+}
+
+// TokenizeFile works like Tokenize but records the file name in the position of every token.
+// Lexing continues after invalid characters, and all of them are returned together as diag.Diagnostics.
+func TokenizeFile(file, input string) ([]token.Token, error) {
+	lx := NewFile(file, strings.NewReader(input))
+
+	var tokens []token.Token
+	for tk := lx.NextToken(); tk.Type() != token.EOFType; tk = lx.NextToken() {
+		tokens = append(tokens, tk)
+	}
+
+	return tokens, lx.Err()
+}
 
-	for tk := lx.peek(); tk != 0; tk = lx.next() {
-		if isNumeric(tk) {
-			value := lx.parseInteger()
-			lx.pushToken(token.Integer{Value: value})
-			continue
+// lexToken reads characters until a token has been added to the queue.
+// At the end of the input an EOF token is added.
+func (lx *Lexer) lexToken() {
+	queued := len(lx.queue)
+
+	for len(lx.queue) == queued {
+		lx.startToken()
+
+		tk := lx.peek()
+		if tk == 0 {
+			lx.pushToken(token.EOF{})
+			return
 		}
 
-		if isAlpha(tk) {
-			value := lx.parseAlpha()
+		lx.lexChar(tk)
 
-			// Check if the value is a reserved keyword
-			if keyword, ok := keywords[value]; ok {
-				lx.pushToken(keyword)
-				continue
-			}
+		// Move past the last character handled
+		lx.next()
+	}
+}
+
+// lexChar lexes the token starting with the current character.
+// The position is left at the last character of the token.
+func (lx *Lexer) lexChar(tk rune) {
+	if isNumeric(tk) || (tk == '.' && isNumeric(lx.at(lx.pos+1))) {
+		lx.lexNumber()
+		return
+	}
 
-			lx.pushToken(token.Identifier{Value: value})
+	if isLetter(tk) {
+		value := lx.lexIdentifier()
 
-			continue
+		// Check if the value is a reserved keyword
+		if keyword, ok := token.LookupKeyword(value); ok {
+			lx.pushToken(keyword)
+			return
 		}
 
-		switch tk {
-		case ' ', '\n', '\t':
-			// Skip whitespace
-		case '+', '-', '*', '/':
+		lx.pushToken(token.Identifier{Value: value})
+		return
+	}
+
+	switch tk {
+	case ' ', '\n', '\t':
+		// Skip whitespace
+	case '/':
+		switch lx.next() {
+		case '/':
+			lx.lexLineComment()
+		case '*':
+			lx.lexBlockComment()
+		case '=':
+			lx.pushToken(token.Operator{Op: "/="})
+		default:
+			lx.putBack()
+			lx.pushToken(token.Operator{Op: "/"})
+		}
+	case '+', '-':
+		switch lx.next() {
+		case '=':
+			lx.pushToken(token.Operator{Op: string(tk) + "="})
+		case tk:
+			lx.pushToken(token.Operator{Op: string(tk) + string(tk)})
+		default:
+			lx.putBack()
 			lx.pushToken(token.Operator{Op: string(tk)})
-		case '(':
-			lx.pushToken(token.OpenParen{})
-		case ')':
-			lx.pushToken(token.CloseParen{})
-		case '{':
-			lx.pushToken(token.OpenBrace{})
-		case '}':
-			lx.pushToken(token.CloseBrace{})
-		case ';':
-			lx.pushToken(token.Semicolon{})
-		case ',':
-			lx.pushToken(token.Comma{})
-		case '&':
-			if lx.next() == '&' {
-				lx.pushToken(token.Operator{Op: "&&"})
-			} else {
-				return nil, fmt.Errorf("invalid character: %c", tk)
-			}
-		case '|':
-			if lx.next() == '|' {
-				lx.pushToken(token.Operator{Op: "||"})
-			} else {
-				return nil, fmt.Errorf("invalid character: %c", tk)
-			}
+		}
+	case '*':
+		if lx.next() == '=' {
+			lx.pushToken(token.Operator{Op: "*="})
+		} else {
+			lx.putBack()
+			lx.pushToken(token.Operator{Op: "*"})
+		}
+	case '(':
+		lx.pushToken(token.OpenParen{})
+	case ')':
+		lx.pushToken(token.CloseParen{})
+	case '{':
+		lx.pushToken(token.OpenBrace{})
+	case '}':
+		lx.pushToken(token.CloseBrace{})
+	case '[':
+		lx.pushToken(token.OpenBracket{})
+	case ']':
+		lx.pushToken(token.CloseBracket{})
+	case ':':
+		lx.pushToken(token.Colon{})
+	case ';':
+		lx.pushToken(token.Semicolon{})
+	case ',':
+		lx.pushToken(token.Comma{})
+	case '"':
+		lx.lexString()
+	case '&':
+		if lx.next() == '&' {
+			lx.pushToken(token.Operator{Op: "&&"})
+		} else {
+			lx.putBack()
+			lx.errorf("invalid character: %c", tk)
+		}
+	case '|':
+		if lx.next() == '|' {
+			lx.pushToken(token.Operator{Op: "||"})
+		} else {
+			lx.putBack()
+			lx.errorf("invalid character: %c", tk)
+		}
 
-		case '!':
-			if lx.next() == '=' {
-				lx.pushToken(token.Operator{Op: "!="})
-			} else {
-				lx.putBack()
-				lx.pushToken(token.Operator{Op: "!"})
-			}
+	case '!':
+		if lx.next() == '=' {
+			lx.pushToken(token.Operator{Op: "!="})
+		} else {
+			lx.putBack()
+			lx.pushToken(token.Operator{Op: "!"})
+		}
+
+	case '>':
+		if lx.next() == '=' {
+			lx.pushToken(token.Operator{Op: ">="})
+		} else {
+			lx.putBack()
+			lx.pushToken(token.Operator{Op: ">"})
+		}
+	case '<':
+		if lx.next() == '=' {
+			lx.pushToken(token.Operator{Op: "<="})
+		} else {
+			lx.putBack()
+			lx.pushToken(token.Operator{Op: "<"})
+		}
+
+	case '=':
+		if lx.next() == '=' {
+			lx.pushToken(token.Operator{Op: "=="})
+		} else {
+			lx.putBack()
+			lx.pushToken(token.Operator{Op: "="})
+		}
+
+	default:
+		lx.errorf("invalid character: %c", tk)
+	}
+}
+
+// lexLineComment skips a // comment up to the end of the line, the position is at the second slash.
+func (lx *Lexer) lexLineComment() {
+	textStart := lx.pos + 1
+
+	char := lx.next()
+	for char != '\n' && char != 0 {
+		char = lx.next()
+	}
+
+	text := lx.text(textStart, lx.pos)
+
+	// Leave the position at the last character of the comment
+	lx.putBack()
 
-		case '>':
-			if lx.next() == '=' {
-				lx.pushToken(token.Operator{Op: ">="})
-			} else {
-				lx.putBack()
-				lx.pushToken(token.Operator{Op: ">"})
+	lx.addDoc(strings.TrimPrefix(text, " "))
+}
+
+// lexBlockComment skips a /* */ comment, the position is at the opening star.
+// Block comments nest, so that code containing comments can be commented out.
+func (lx *Lexer) lexBlockComment() {
+	textStart := lx.pos + 1
+	depth := 1
+
+	for depth > 0 {
+		switch lx.next() {
+		case 0:
+			lx.putBack()
+			lx.errorFrom(lx.start, "unterminated block comment")
+			return
+		case '/':
+			if lx.at(lx.pos+1) == '*' {
+				lx.pos++
+				depth++
 			}
-		case '<':
-			if lx.next() == '=' {
-				lx.pushToken(token.Operator{Op: "<="})
-			} else {
-				lx.putBack()
-				lx.pushToken(token.Operator{Op: "<"})
+		case '*':
+			if lx.at(lx.pos+1) == '/' {
+				lx.pos++
+				depth--
 			}
+		}
+	}
 
-		case '=':
-			if lx.next() == '=' {
-				lx.pushToken(token.Operator{Op: "=="})
-			} else {
-				lx.putBack()
-				lx.pushToken(token.Operator{Op: "="})
-			}
+	lx.addDoc(strings.TrimSpace(lx.text(textStart, lx.pos-1)))
+}
 
-		default:
-			return nil, fmt.Errorf("invalid character: %c", tk)
-		}
+// addDoc records the text of the comment that was just lexed as a possible doc comment.
+// Only comments that are alone on their lines are kept, and they must be on consecutive lines.
+func (lx *Lexer) addDoc(text string) {
+	start := lx.startPos
+	if start.Line == lx.lastLine {
+		// The comment follows code on the same line
+		lx.doc = nil
+		return
+	}
+
+	if len(lx.doc) > 0 && lx.docEnd != start.Line-1 {
+		lx.doc = nil
 	}
 
-	return lx.tokens, nil
+	lx.doc = append(lx.doc, text)
+	lx.docEnd = lx.position(lx.pos).Line
 }
 
-func isNumeric(char byte) bool {
+func isNumeric(char rune) bool {
 	return char >= '0' && char <= '9'
 }
 
-func (lx *lexer) parseInteger() int {
-	value := int(lx.peek() - '0')
+// lexNumber lexes an integer or float literal starting at the current character.
+// Integers can be written in hex (0x1F), octal (0o17) and binary (0b1010) as well as decimal,
+// and the digits of any literal can be separated by underscores (1_000_000).
+// A decimal literal is a float if it has a fraction or an exponent, as in 1.5, .5 and 1e-3.
+func (lx *Lexer) lexNumber() {
+	base, digitsStart := 10, lx.pos
+	if lx.at(lx.pos) == '0' {
+		switch lx.at(lx.pos + 1) {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			digitsStart = lx.pos + 2
+		}
+	}
 
-	for isNumeric(lx.next()) {
-		value = value*10 + int(lx.peek()-'0')
+	end := lx.skipDigits(digitsStart, base)
+	isFloat := false
 
+	if base == 10 && lx.at(end) == '.' && isNumeric(lx.at(end+1)) {
+		isFloat = true
+		end = lx.skipDigits(end+1, base)
 	}
 
-	// Put back the last character so that we do not return with the position past the bounds of what this funciton handled.
-	lx.putBack()
+	if base == 10 && (lx.at(end) == 'e' || lx.at(end) == 'E') {
+		exp := end + 1
+		if lx.at(exp) == '+' || lx.at(exp) == '-' {
+			exp++
+		}
+
+		if !isNumeric(lx.at(exp)) {
+			lx.pos = exp - 1
+			lx.numberError(true, "invalid exponent in number literal")
+			return
+		}
+
+		isFloat = true
+		end = lx.skipDigits(exp, base)
+	}
+
+	// Leave the position at the last character of the literal
+	lx.pos = end - 1
+	text := lx.text(lx.start, end)
+	digits := lx.text(digitsStart, end)
+
+	if digits == "" {
+		lx.numberError(isFloat, "missing digits in number literal: %s", text)
+		return
+	}
+
+	// The digits only hold ASCII characters, so they can be indexed by byte
+	for i := 0; i < len(digits); i++ {
+		char := rune(digits[i])
+		if char == '_' && (i == 0 || i == len(digits)-1 || !isHex(rune(digits[i-1])) || !isHex(rune(digits[i+1]))) {
+			lx.numberError(isFloat, "_ must separate digits in number literal: %s", text)
+			return
+		}
+		if isHex(char) && hexValue(char) >= base && !isFloat {
+			lx.numberError(isFloat, "invalid digit %c in base %d literal: %s", char, base, text)
+			return
+		}
+	}
 
-	return value
+	digits = strings.ReplaceAll(digits, "_", "")
+
+	if isFloat {
+		value, err := strconv.ParseFloat(digits, 64)
+		if err != nil {
+			lx.numberError(true, "invalid float literal: %s", text)
+			return
+		}
+		lx.pushToken(token.Float{Value: value})
+		return
+	}
+
+	value, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		lx.numberError(false, "integer literal out of range: %s", text)
+		return
+	}
+	lx.pushToken(token.Integer{Value: value})
 }
 
-func isAlpha(char byte) bool {
-	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+// numberError reports an invalid number literal and pushes a zero literal in its place,
+// so that the parser does not report a missing value as well.
+func (lx *Lexer) numberError(isFloat bool, format string, args ...any) {
+	lx.errorf(format, args...)
+
+	if isFloat {
+		lx.pushToken(token.Float{})
+	} else {
+		lx.pushToken(token.Integer{})
+	}
 }
 
-func (lx *lexer) parseAlpha() string {
-	value := strings.Builder{}
-	value.WriteByte(lx.peek())
+// skipDigits returns the offset of the first character at or after offset that is not a digit or separator.
+// Decimal digits are accepted for all bases below 10 so that invalid digits are reported as part of the literal.
+func (lx *Lexer) skipDigits(offset int, base int) int {
+	for {
+		char := lx.at(offset)
+		if !isNumeric(char) && char != '_' && (base != 16 || !isHex(char)) {
+			return offset
+		}
+		offset++
+	}
+}
 
-	for isAlpha(lx.next()) {
-		value.WriteByte(lx.peek())
+// isLetter reports whether char can start an identifier, which is a Unicode letter or an underscore.
+func isLetter(char rune) bool {
+	return char == '_' || unicode.IsLetter(char)
+}
+
+// lexIdentifier lexes an identifier or keyword, a letter followed by any number of letters and digits.
+func (lx *Lexer) lexIdentifier() string {
+	char := lx.next()
+	for isLetter(char) || unicode.IsDigit(char) {
+		char = lx.next()
 	}
 
 	// Put back the last character so that we do not return with the position past the bounds of what this funciton handled.
 	lx.putBack()
 
-	return value.String()
+	return lx.text(lx.start, lx.end())
+}
+
+// lexString lexes a string literal starting at the opening quote.
+// Invalid escape sequences are reported and skipped so that the rest of the literal is still lexed.
+func (lx *Lexer) lexString() {
+	value := strings.Builder{}
+
+	for {
+		switch char := lx.next(); char {
+		case '"':
+			lx.pushToken(token.String{Value: value.String()})
+			return
+		case 0, '\n':
+			// Leave the newline to the caller, string literals can not span multiple lines
+			lx.putBack()
+			lx.errorf("unterminated string literal")
+			return
+		case '\\':
+			lx.lexEscape(&value)
+		default:
+			value.WriteRune(char)
+		}
+	}
+}
+
+// lexEscape lexes the escape sequence following a backslash and writes the resulting character to value.
+func (lx *Lexer) lexEscape(value *strings.Builder) {
+	start := lx.pos
+
+	switch char := lx.next(); char {
+	case 'n':
+		value.WriteByte('\n')
+	case 't':
+		value.WriteByte('\t')
+	case '"':
+		value.WriteByte('"')
+	case '\\':
+		value.WriteByte('\\')
+	case 'u':
+		lx.lexUnicodeEscape(value, start)
+	case 0, '\n':
+		// The string is unterminated, which is reported by lexString
+		lx.putBack()
+	default:
+		lx.errorFrom(start, "unknown escape sequence: \\%c", char)
+	}
+}
+
+// lexUnicodeEscape lexes the {...} part of a \u{...} escape sequence, holding 1 to 6 hexadecimal digits.
+func (lx *Lexer) lexUnicodeEscape(value *strings.Builder, start int) {
+	if lx.next() != '{' {
+		lx.putBack()
+		lx.errorFrom(start, "invalid unicode escape: expected {")
+		return
+	}
+
+	code, digits := 0, 0
+	for isHex(lx.next()) {
+		code = code*16 + hexValue(lx.peek())
+		digits++
+	}
+
+	if lx.peek() != '}' {
+		lx.putBack()
+		lx.errorFrom(start, "invalid unicode escape: expected }")
+		return
+	}
+
+	if digits == 0 || digits > 6 || !utf8.ValidRune(rune(code)) {
+		lx.errorFrom(start, "invalid unicode escape: %s", lx.text(start, lx.pos+1))
+		return
+	}
+
+	value.WriteRune(rune(code))
+}
+
+func isHex(char rune) bool {
+	return isNumeric(char) || (char >= 'a' && char <= 'f') || (char >= 'A' && char <= 'F')
+}
+
+func hexValue(char rune) int {
+	switch {
+	case char >= 'a':
+		return int(char-'a') + 10
+	case char >= 'A':
+		return int(char-'A') + 10
+	default:
+		return int(char - '0')
+	}
 }
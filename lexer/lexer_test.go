@@ -1,31 +1,44 @@
 package lexer_test
 
 import (
+	"errors"
+	"fmt"
+	"leoscript/diag"
 	"leoscript/lexer"
 	"leoscript/token"
 	"leoscript/types"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// withoutSpans clears the source positions of the tokens so that they can be compared to literals.
+func withoutSpans(tokens []token.Token) []token.Token {
+	for i, tk := range tokens {
+		tokens[i] = tk.WithSpan(token.Span{})
+	}
+	return tokens
+}
+
 func Test_MathExpression(t *testing.T) {
 	t.Run("Single digit", func(t *testing.T) {
-		lx := lexer.MustTokenize("1")
+		lx := withoutSpans(lexer.MustTokenize("1"))
 		assert.Equal(t, []token.Token{
 			token.Integer{Value: 1},
 		}, lx)
 	})
 
 	t.Run("Single number", func(t *testing.T) {
-		lx := lexer.MustTokenize("12345")
+		lx := withoutSpans(lexer.MustTokenize("12345"))
 		assert.Equal(t, []token.Token{
 			token.Integer{Value: 12345},
 		}, lx)
 	})
 
 	t.Run("Binary ops with whitespace", func(t *testing.T) {
-		lx := lexer.MustTokenize("1+ 2- 3 *4/ 5")
+		lx := withoutSpans(lexer.MustTokenize("1+ 2- 3 *4/ 5"))
 		assert.Equal(t, []token.Token{
 			token.Integer{Value: 1},
 			token.Operator{Op: "+"},
@@ -39,8 +52,24 @@ func Test_MathExpression(t *testing.T) {
 		}, lx)
 	})
 
+	t.Run("Assignment operators", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize("a+=1 -= *=/= ++ -- - -"))
+		assert.Equal(t, []token.Token{
+			token.Identifier{Value: "a"},
+			token.Operator{Op: "+="},
+			token.Integer{Value: 1},
+			token.Operator{Op: "-="},
+			token.Operator{Op: "*="},
+			token.Operator{Op: "/="},
+			token.Operator{Op: "++"},
+			token.Operator{Op: "--"},
+			token.Operator{Op: "-"},
+			token.Operator{Op: "-"},
+		}, lx)
+	})
+
 	t.Run("Multiple digit numbers", func(t *testing.T) {
-		lx := lexer.MustTokenize("123+456789-987 7898 / 898989")
+		lx := withoutSpans(lexer.MustTokenize("123+456789-987 7898 / 898989"))
 		assert.Equal(t, []token.Token{
 			token.Integer{Value: 123},
 			token.Operator{Op: "+"},
@@ -59,7 +88,7 @@ func Test_MathExpression(t *testing.T) {
 	})
 
 	t.Run("Parentheses", func(t *testing.T) {
-		lx := lexer.MustTokenize("((1+2)*3);")
+		lx := withoutSpans(lexer.MustTokenize("((1+2)*3);"))
 		assert.Equal(t, []token.Token{
 			token.OpenParen{},
 			token.OpenParen{},
@@ -74,11 +103,25 @@ func Test_MathExpression(t *testing.T) {
 		}, lx)
 	})
 
+	t.Run("Brackets", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize("a[1:] in []int"))
+		assert.Equal(t, []token.Token{
+			token.Identifier{Value: "a"},
+			token.OpenBracket{},
+			token.Integer{Value: 1},
+			token.Colon{},
+			token.CloseBracket{},
+			token.In{},
+			token.OpenBracket{},
+			token.CloseBracket{},
+			token.Type{Kind: types.Int},
+		}, lx)
+	})
 }
 
 func Test_Identifiers(t *testing.T) {
 	t.Run("Identifiers", func(t *testing.T) {
-		lx := lexer.MustTokenize("foo + bar-baz")
+		lx := withoutSpans(lexer.MustTokenize("foo + bar-baz"))
 		assert.Equal(t, []token.Token{
 			token.Identifier{Value: "foo"},
 			token.Operator{Op: "+"},
@@ -89,7 +132,7 @@ func Test_Identifiers(t *testing.T) {
 	})
 
 	t.Run("Reserved keywords", func(t *testing.T) {
-		lx := lexer.MustTokenize("true false")
+		lx := withoutSpans(lexer.MustTokenize("true false"))
 		assert.Equal(t, []token.Token{
 			token.Boolean{Value: true},
 			token.Boolean{Value: false},
@@ -97,14 +140,23 @@ func Test_Identifiers(t *testing.T) {
 	})
 
 	t.Run("Combined keywords, fine", func(t *testing.T) {
-		lx := lexer.MustTokenize("truefalse")
+		lx := withoutSpans(lexer.MustTokenize("truefalse"))
 		assert.Equal(t, []token.Token{
 			token.Identifier{Value: "truefalse"},
 		}, lx)
 	})
 
+	t.Run("Control flow keywords", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize("if else iffy"))
+		assert.Equal(t, []token.Token{
+			token.If{},
+			token.Else{},
+			token.Identifier{Value: "iffy"},
+		}, lx)
+	})
+
 	t.Run("Mixed identifiers and keywords", func(t *testing.T) {
-		lx := lexer.MustTokenize("true foo false bar")
+		lx := withoutSpans(lexer.MustTokenize("true foo false bar"))
 		assert.Equal(t, []token.Token{
 			token.Boolean{Value: true},
 			token.Identifier{Value: "foo"},
@@ -112,11 +164,45 @@ func Test_Identifiers(t *testing.T) {
 			token.Identifier{Value: "bar"},
 		}, lx)
 	})
+	t.Run("Digits and underscores", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize("user_id x2 _tmp __ 2x"))
+		assert.Equal(t, []token.Token{
+			token.Identifier{Value: "user_id"},
+			token.Identifier{Value: "x2"},
+			token.Identifier{Value: "_tmp"},
+			token.Identifier{Value: "__"},
+			token.Integer{Value: 2},
+			token.Identifier{Value: "x"},
+		}, lx)
+	})
+
+	t.Run("Unicode letters", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize("größe + π2 - 名前"))
+		assert.Equal(t, []token.Token{
+			token.Identifier{Value: "größe"},
+			token.Operator{Op: "+"},
+			token.Identifier{Value: "π2"},
+			token.Operator{Op: "-"},
+			token.Identifier{Value: "名前"},
+		}, lx)
+	})
+
+	t.Run("Columns count characters", func(t *testing.T) {
+		tokens := lexer.MustTokenize("größe = 1;")
+		assert.Equal(t, token.Span{
+			Start: token.Position{Offset: 0, Line: 1, Column: 1},
+			End:   token.Position{Offset: 7, Line: 1, Column: 6},
+		}, tokens[0].Span())
+		assert.Equal(t, "1:7", tokens[1].Span().Start.String())
+
+		_, err := lexer.Tokenize("\"é\" € 1")
+		assert.EqualError(t, err, "1:5: invalid character: €")
+	})
 }
 
 func Test_LogicalExpressions(t *testing.T) {
 	t.Run("Logical operators", func(t *testing.T) {
-		lx := lexer.MustTokenize("true && false || true")
+		lx := withoutSpans(lexer.MustTokenize("true && false || true"))
 		assert.Equal(t, []token.Token{
 			token.Boolean{Value: true},
 			token.Operator{Op: "&&"},
@@ -127,7 +213,7 @@ func Test_LogicalExpressions(t *testing.T) {
 	})
 
 	t.Run("Parentheses", func(t *testing.T) {
-		lx := lexer.MustTokenize("(true && false) || true")
+		lx := withoutSpans(lexer.MustTokenize("(true && false) || true"))
 		assert.Equal(t, []token.Token{
 			token.OpenParen{},
 			token.Boolean{Value: true},
@@ -140,7 +226,7 @@ func Test_LogicalExpressions(t *testing.T) {
 	})
 
 	t.Run("With identifiers", func(t *testing.T) {
-		lx := lexer.MustTokenize("true && bar || baz")
+		lx := withoutSpans(lexer.MustTokenize("true && bar || baz"))
 		assert.Equal(t, []token.Token{
 			token.Boolean{Value: true},
 			token.Operator{Op: "&&"},
@@ -156,7 +242,7 @@ func Test_LogicalExpressions(t *testing.T) {
 	})
 
 	t.Run("Comparison operators", func(t *testing.T) {
-		lx := lexer.MustTokenize("1 < 2 > 3 <= 4 >= 5 == 6 != 7")
+		lx := withoutSpans(lexer.MustTokenize("1 < 2 > 3 <= 4 >= 5 == 6 != 7"))
 		assert.Equal(t, []token.Token{
 			token.Integer{Value: 1},
 			token.Operator{Op: "<"},
@@ -177,7 +263,7 @@ func Test_LogicalExpressions(t *testing.T) {
 
 func Test_VariableDeclaration(t *testing.T) {
 	t.Run("Variable declaration", func(t *testing.T) {
-		lx := lexer.MustTokenize("var foo = 123;")
+		lx := withoutSpans(lexer.MustTokenize("var foo = 123;"))
 		assert.Equal(t, []token.Token{
 			token.VarDecl{},
 			token.Identifier{Value: "foo"},
@@ -187,8 +273,20 @@ func Test_VariableDeclaration(t *testing.T) {
 		}, lx)
 	})
 
+	t.Run("Constant declaration", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize("const int foo = 1;"))
+		assert.Equal(t, []token.Token{
+			token.Const{},
+			token.Type{Kind: types.Int},
+			token.Identifier{Value: "foo"},
+			token.Operator{Op: "="},
+			token.Integer{Value: 1},
+			token.Semicolon{},
+		}, lx)
+	})
+
 	t.Run("Variable declaration with expression", func(t *testing.T) {
-		lx := lexer.MustTokenize("var foo = 1 + 2 * 3;")
+		lx := withoutSpans(lexer.MustTokenize("var foo = 1 + 2 * 3;"))
 		assert.Equal(t, []token.Token{
 			token.VarDecl{},
 			token.Identifier{Value: "foo"},
@@ -203,7 +301,7 @@ func Test_VariableDeclaration(t *testing.T) {
 	})
 
 	t.Run("Integer variable declaration", func(t *testing.T) {
-		lx := lexer.MustTokenize("int foo = 123;")
+		lx := withoutSpans(lexer.MustTokenize("int foo = 123;"))
 		assert.Equal(t, []token.Token{
 			token.Type{Kind: types.Int},
 			token.Identifier{Value: "foo"},
@@ -214,7 +312,7 @@ func Test_VariableDeclaration(t *testing.T) {
 	})
 
 	t.Run("Boolean variable declaration", func(t *testing.T) {
-		lx := lexer.MustTokenize("bool foo = true;")
+		lx := withoutSpans(lexer.MustTokenize("bool foo = true;"))
 		assert.Equal(t, []token.Token{
 			token.Type{Kind: types.Bool},
 			token.Identifier{Value: "foo"},
@@ -238,7 +336,7 @@ func Test_VariableDeclaration(t *testing.T) {
 
 func Test_FunctionDefinition(t *testing.T) {
 	t.Run("Function definition", func(t *testing.T) {
-		lx := lexer.MustTokenize("fn foo() {}")
+		lx := withoutSpans(lexer.MustTokenize("fn foo() {}"))
 		assert.Equal(t, []token.Token{
 			token.FnDef{},
 			token.Identifier{Value: "foo"},
@@ -266,3 +364,339 @@ func Test_FunctionDefinition(t *testing.T) {
 	// err := lexer.MustTokenize("fn foo(a) { return 1 + 2; }"
 	// })
 }
+
+func Test_Positions(t *testing.T) {
+	t.Run("Token spans", func(t *testing.T) {
+		tokens := lexer.MustTokenize("var foo = 12;\n  foo >= 3;")
+
+		assert.Equal(t, token.Span{
+			Start: token.Position{Offset: 0, Line: 1, Column: 1},
+			End:   token.Position{Offset: 3, Line: 1, Column: 4},
+		}, tokens[0].Span())
+
+		assert.Equal(t, token.Span{
+			Start: token.Position{Offset: 10, Line: 1, Column: 11},
+			End:   token.Position{Offset: 12, Line: 1, Column: 13},
+		}, tokens[3].Span())
+
+		assert.Equal(t, token.Span{
+			Start: token.Position{Offset: 20, Line: 2, Column: 7},
+			End:   token.Position{Offset: 22, Line: 2, Column: 9},
+		}, tokens[6].Span())
+	})
+
+	t.Run("File name", func(t *testing.T) {
+		tokens, err := lexer.TokenizeFile("main.leo", "\n\ttrue")
+		assert.NoError(t, err)
+		assert.Equal(t, "main.leo:2:2", tokens[0].Span().Start.String())
+	})
+
+	t.Run("Error position", func(t *testing.T) {
+		_, err := lexer.TokenizeFile("main.leo", "1 +\n 2 $ 3")
+		assert.EqualError(t, err, "main.leo:2:4: invalid character: $")
+	})
+}
+
+func Test_Diagnostics(t *testing.T) {
+	t.Run("All invalid characters are reported", func(t *testing.T) {
+		tokens, err := lexer.Tokenize("1 $ 2\n# 3")
+
+		var diags diag.Diagnostics
+		assert.ErrorAs(t, err, &diags)
+		assert.Len(t, diags, 2)
+		assert.Equal(t, diag.CodeInvalidCharacter, diags[0].Code)
+		assert.EqualError(t, err, "1:3: invalid character: $\n2:1: invalid character: #")
+
+		// Lexing continues past the invalid characters
+		assert.Equal(t, []token.Token{
+			token.Integer{Value: 1},
+			token.Integer{Value: 2},
+			token.Integer{Value: 3},
+		}, withoutSpans(tokens))
+	})
+}
+
+func Test_Strings(t *testing.T) {
+	t.Run("Literals", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize(`string s = "hello" + "";`))
+		assert.Equal(t, []token.Token{
+			token.Type{Kind: types.String},
+			token.Identifier{Value: "s"},
+			token.Operator{Op: "="},
+			token.String{Value: "hello"},
+			token.Operator{Op: "+"},
+			token.String{Value: ""},
+			token.Semicolon{},
+		}, lx)
+	})
+
+	t.Run("Escape sequences", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize(`"a\nb\tc\"d\\e\u{41}\u{1F600}é"`))
+		assert.Equal(t, []token.Token{
+			token.String{Value: "a\nb\tc\"d\\eA😀é"},
+		}, lx)
+	})
+
+	t.Run("Span includes the quotes", func(t *testing.T) {
+		tokens := lexer.MustTokenize(`x "a\n"`)
+		assert.Equal(t, token.Span{
+			Start: token.Position{Offset: 2, Line: 1, Column: 3},
+			End:   token.Position{Offset: 7, Line: 1, Column: 8},
+		}, tokens[1].Span())
+	})
+
+	t.Run("Invalid escapes", func(t *testing.T) {
+		tokens, err := lexer.Tokenize(`"a\qb" "\u{110000}" "\u41"`)
+		assert.EqualError(t, err, "1:3: unknown escape sequence: \\q\n1:9: invalid unicode escape: \\u{110000}\n1:22: invalid unicode escape: expected {")
+
+		// The rest of the literals are still lexed
+		assert.Equal(t, []token.Token{
+			token.String{Value: "ab"},
+			token.String{Value: ""},
+			token.String{Value: "41"},
+		}, withoutSpans(tokens))
+	})
+
+	t.Run("Unterminated", func(t *testing.T) {
+		tokens, err := lexer.Tokenize("\"abc\n1")
+		assert.EqualError(t, err, "1:1: unterminated string literal")
+		assert.Equal(t, []token.Token{token.Integer{Value: 1}}, withoutSpans(tokens))
+
+		_, err = lexer.Tokenize(`"abc\`)
+		assert.EqualError(t, err, "1:1: unterminated string literal")
+	})
+}
+
+func Test_Floats(t *testing.T) {
+	t.Run("Literals", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize("1.5 .5 1e-3 2.5E+2 3e2 10"))
+		assert.Equal(t, []token.Token{
+			token.Float{Value: 1.5},
+			token.Float{Value: 0.5},
+			token.Float{Value: 0.001},
+			token.Float{Value: 250},
+			token.Float{Value: 300},
+			token.Integer{Value: 10},
+		}, lx)
+	})
+
+	t.Run("Float declaration", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize("float price = 9.99 * 2;"))
+		assert.Equal(t, []token.Token{
+			token.Type{Kind: types.Float},
+			token.Identifier{Value: "price"},
+			token.Operator{Op: "="},
+			token.Float{Value: 9.99},
+			token.Operator{Op: "*"},
+			token.Integer{Value: 2},
+			token.Semicolon{},
+		}, lx)
+	})
+
+	t.Run("Span", func(t *testing.T) {
+		tokens := lexer.MustTokenize("x 1.25e1;")
+		assert.Equal(t, token.Span{
+			Start: token.Position{Offset: 2, Line: 1, Column: 3},
+			End:   token.Position{Offset: 8, Line: 1, Column: 9},
+		}, tokens[1].Span())
+	})
+
+	t.Run("Invalid exponent", func(t *testing.T) {
+		tokens, err := lexer.Tokenize("1 + 2e-;")
+		assert.EqualError(t, err, "1:5: invalid exponent in number literal")
+		assert.Equal(t, token.Float{}, withoutSpans(tokens)[2])
+	})
+}
+
+func Test_IntegerLiterals(t *testing.T) {
+	t.Run("Bases and separators", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize("0x1F 0XfF 0o17 0b1010 1_000_000 007 1_0.5"))
+		assert.Equal(t, []token.Token{
+			token.Integer{Value: 31},
+			token.Integer{Value: 255},
+			token.Integer{Value: 15},
+			token.Integer{Value: 10},
+			token.Integer{Value: 1000000},
+			token.Integer{Value: 7},
+			token.Float{Value: 10.5},
+		}, lx)
+	})
+
+	t.Run("Ints are 64 bits", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize("9223372036854775807 0x7fff_ffff_ffff_ffff"))
+		assert.Equal(t, []token.Token{
+			token.Integer{Value: 9223372036854775807},
+			token.Integer{Value: 9223372036854775807},
+		}, lx)
+	})
+
+	t.Run("Out of range", func(t *testing.T) {
+		tokens, err := lexer.Tokenize("1 + 99999999999999999999;\n0x1_0000_0000_0000_0000")
+		assert.EqualError(t, err, "1:5: integer literal out of range: 99999999999999999999\n2:1: integer literal out of range: 0x1_0000_0000_0000_0000")
+
+		// The literal is read as a whole and replaced by a zero, so that the parser does not miss a value
+		assert.Equal(t, []token.Token{
+			token.Integer{Value: 1},
+			token.Operator{Op: "+"},
+			token.Integer{},
+			token.Semicolon{},
+			token.Integer{},
+		}, withoutSpans(tokens))
+	})
+
+	t.Run("Invalid literals", func(t *testing.T) {
+		_, err := lexer.Tokenize("0b102 0o8 0x 1__0 10_ 0xG")
+		assert.EqualError(t, err, "1:1: invalid digit 2 in base 2 literal: 0b102\n"+
+			"1:7: invalid digit 8 in base 8 literal: 0o8\n"+
+			"1:11: missing digits in number literal: 0x\n"+
+			"1:14: _ must separate digits in number literal: 1__0\n"+
+			"1:19: _ must separate digits in number literal: 10_\n"+
+			"1:23: missing digits in number literal: 0x")
+	})
+
+	t.Run("Span", func(t *testing.T) {
+		tokens := lexer.MustTokenize("0b1_1;")
+		assert.Equal(t, token.Span{
+			Start: token.Position{Offset: 0, Line: 1, Column: 1},
+			End:   token.Position{Offset: 5, Line: 1, Column: 6},
+		}, tokens[0].Span())
+	})
+}
+
+func Test_Comments(t *testing.T) {
+	t.Run("Line comments", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize("// leading\n1 / 2; // trailing\n// at the end"))
+		assert.Equal(t, []token.Token{
+			token.Integer{Value: 1},
+			token.Operator{Op: "/"},
+			token.Integer{Value: 2},
+			token.Semicolon{},
+		}, lx)
+	})
+
+	t.Run("Block comments", func(t *testing.T) {
+		lx := withoutSpans(lexer.MustTokenize("1 /* a\n * b */ + /**/ 2 /* outer /* inner */ still a comment */;"))
+		assert.Equal(t, []token.Token{
+			token.Integer{Value: 1},
+			token.Operator{Op: "+"},
+			token.Integer{Value: 2},
+			token.Semicolon{},
+		}, lx)
+	})
+
+	t.Run("Positions after comments", func(t *testing.T) {
+		tokens := lexer.MustTokenize("/* one\ntwo */ x")
+		assert.Equal(t, "2:8", tokens[0].Span().Start.String())
+	})
+
+	t.Run("Unterminated block comment", func(t *testing.T) {
+		tokens, err := lexer.Tokenize("1;\n/* a /* b */ c")
+		assert.EqualError(t, err, "2:1: unterminated block comment")
+		assert.Equal(t, []token.Token{
+			token.Integer{Value: 1},
+			token.Semicolon{},
+		}, withoutSpans(tokens))
+	})
+
+	t.Run("Doc comments", func(t *testing.T) {
+		tokens := withoutSpans(lexer.MustTokenize(`
+			// add returns the sum of a and b.
+			//
+			// It never fails.
+			fn add() {}
+
+			// Not attached, separated by a blank line.
+
+			fn b() {}
+			var x = 1; // Not attached, after code.
+			fn c() {}
+			/* Block comments are doc comments too. */
+			fn d() {}
+		`))
+
+		var docs []string
+		for _, tk := range tokens {
+			if fn, ok := tk.(token.FnDef); ok {
+				docs = append(docs, fn.Doc)
+			}
+		}
+
+		assert.Equal(t, []string{
+			"add returns the sum of a and b.\n\nIt never fails.",
+			"",
+			"",
+			"Block comments are doc comments too.",
+		}, docs)
+	})
+}
+
+func Test_Lexer(t *testing.T) {
+	t.Run("Pull tokens one at a time", func(t *testing.T) {
+		lx := lexer.New(strings.NewReader("var x = 1;"))
+
+		assert.Equal(t, token.VarDecl{}, lx.NextToken().WithSpan(token.Span{}))
+		assert.Equal(t, token.Identifier{Value: "x"}, lx.NextToken().WithSpan(token.Span{}))
+
+		// Peeking does not consume the tokens
+		assert.Equal(t, token.Integer{Value: 1}, lx.Peek(1).WithSpan(token.Span{}))
+		assert.Equal(t, token.Operator{Op: "="}, lx.Peek(0).WithSpan(token.Span{}))
+		assert.Equal(t, token.Operator{Op: "="}, lx.NextToken().WithSpan(token.Span{}))
+		assert.Equal(t, token.Integer{Value: 1}, lx.NextToken().WithSpan(token.Span{}))
+		assert.Equal(t, token.Semicolon{}, lx.NextToken().WithSpan(token.Span{}))
+
+		// EOF is returned at the end, however many times the lexer is asked
+		assert.Equal(t, token.EOFType, lx.Peek(3).Type())
+		assert.Equal(t, token.EOFType, lx.NextToken().Type())
+		assert.Equal(t, token.EOFType, lx.NextToken().Type())
+		assert.NoError(t, lx.Err())
+	})
+
+	t.Run("Characters split between reads", func(t *testing.T) {
+		src := "größe = \"€\"; // ünïcode\nx"
+		lx := lexer.NewFile("main.leo", iotest.OneByteReader(strings.NewReader(src)))
+
+		var tokens []token.Token
+		for tk := lx.NextToken(); tk.Type() != token.EOFType; tk = lx.NextToken() {
+			tokens = append(tokens, tk)
+		}
+		assert.NoError(t, lx.Err())
+
+		assert.Equal(t, lexer.MustTokenize(src)[0].Span().End.Column, tokens[0].Span().End.Column)
+		assert.Equal(t, "main.leo:2:1", tokens[4].Span().Start.String())
+		assert.Equal(t, []token.Token{
+			token.Identifier{Value: "größe"},
+			token.Operator{Op: "="},
+			token.String{Value: "€"},
+			token.Semicolon{},
+			token.Identifier{Value: "x"},
+		}, withoutSpans(tokens))
+	})
+
+	t.Run("Large input", func(t *testing.T) {
+		sb := strings.Builder{}
+		for i := range 5000 {
+			fmt.Fprintf(&sb, "var v%d = %d; /* a comment to pad the line */\n", i, i)
+		}
+
+		lx := lexer.New(strings.NewReader(sb.String()))
+
+		count := 0
+		var last token.Token
+		for tk := lx.NextToken(); tk.Type() != token.EOFType; tk = lx.NextToken() {
+			count++
+			last = tk
+		}
+
+		assert.NoError(t, lx.Err())
+		assert.Equal(t, 5*5000, count)
+		assert.Equal(t, "5000:17", last.Span().Start.String())
+	})
+
+	t.Run("Read errors", func(t *testing.T) {
+		readErr := errors.New("disk on fire")
+		lx := lexer.New(iotest.ErrReader(readErr))
+
+		assert.Equal(t, token.EOFType, lx.NextToken().Type())
+		assert.ErrorIs(t, lx.Err(), readErr)
+	})
+}
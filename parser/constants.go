@@ -0,0 +1,235 @@
+package parser
+
+import (
+	"leoscript/diag"
+	"leoscript/token"
+	"strings"
+)
+
+// constValue evaluates a constant expression to the literal of its value, located at the expression.
+// Constant expressions are built from literals, other constants and operators, and are evaluated
+// the same way as by the interpreter.
+func (p *Parser) constValue(expr Expression) (Expression, error) {
+	switch e := expr.(type) {
+	case IntegerLiteral, FloatLiteral, BooleanLiteral, StringLiteral:
+		return e, nil
+
+	case Identifier:
+		decl, ok := p.scope.ResolveVar(e.Name)
+		if !ok || !decl.Const {
+			return nil, diag.Errorf(diag.CodeNotConstant, e.Span(), "%s is not a constant", e.Name)
+		}
+		return literalAt(decl.Value, e.Span()), nil
+
+	case UnaryExpression:
+		val, err := p.constValue(e.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return foldUnary(e, val)
+
+	case BinaryExpression:
+		left, err := p.constValue(e.Left)
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := p.constValue(e.Right)
+		if err != nil {
+			return nil, err
+		}
+
+		return foldBinary(e, left, right)
+
+	case Call:
+		return nil, diag.Errorf(diag.CodeNotConstant, e.Span(), "call of %s is not a constant expression", e.Name)
+
+	default:
+		return nil, diag.Errorf(diag.CodeNotConstant, e.Span(), "expression is not constant")
+	}
+}
+
+// literalAt returns a copy of the literal located at the given span.
+func literalAt(lit Expression, span token.Span) Expression {
+	switch l := lit.(type) {
+	case IntegerLiteral:
+		l.span = span
+		return l
+	case FloatLiteral:
+		l.span = span
+		return l
+	case BooleanLiteral:
+		l.span = span
+		return l
+	case StringLiteral:
+		l.span = span
+		return l
+	}
+
+	return lit
+}
+
+func foldUnary(e UnaryExpression, val Expression) (Expression, error) {
+	span := e.Span()
+
+	switch v := val.(type) {
+	case IntegerLiteral:
+		switch e.Op {
+		case "-":
+			return IntegerLiteral{Value: -v.Value, span: span}, nil
+		case "+":
+			return IntegerLiteral{Value: v.Value, span: span}, nil
+		}
+	case FloatLiteral:
+		switch e.Op {
+		case "-":
+			return FloatLiteral{Value: -v.Value, span: span}, nil
+		case "+":
+			return FloatLiteral{Value: v.Value, span: span}, nil
+		}
+	case BooleanLiteral:
+		if e.Op == "!" {
+			return BooleanLiteral{Value: !v.Value, span: span}, nil
+		}
+	}
+
+	return nil, diag.Errorf(diag.CodeTypeMismatch, span, "operator %s cannot be used with %v", e.Op, val.ReturnType())
+}
+
+func foldBinary(e BinaryExpression, left, right Expression) (Expression, error) {
+	span := e.Span()
+
+	switch l := left.(type) {
+	case IntegerLiteral:
+		switch r := right.(type) {
+		case IntegerLiteral:
+			return foldInt(e, l.Value, r.Value)
+		case FloatLiteral:
+			// An int is promoted to float when mixed with a float
+			return foldFloat(e, float64(l.Value), r.Value)
+		}
+
+	case FloatLiteral:
+		switch r := right.(type) {
+		case IntegerLiteral:
+			return foldFloat(e, l.Value, float64(r.Value))
+		case FloatLiteral:
+			return foldFloat(e, l.Value, r.Value)
+		}
+
+	case BooleanLiteral:
+		if r, ok := right.(BooleanLiteral); ok {
+			switch e.Op {
+			case "&&":
+				return BooleanLiteral{Value: l.Value && r.Value, span: span}, nil
+			case "||":
+				return BooleanLiteral{Value: l.Value || r.Value, span: span}, nil
+			case "==":
+				return BooleanLiteral{Value: l.Value == r.Value, span: span}, nil
+			case "!=":
+				return BooleanLiteral{Value: l.Value != r.Value, span: span}, nil
+			}
+		}
+
+	case StringLiteral:
+		if r, ok := right.(StringLiteral); ok {
+			if e.Op == "+" {
+				return StringLiteral{Value: l.Value + r.Value, span: span}, nil
+			}
+			if cmp, ok := compareOp(e.Op, strings.Compare(l.Value, r.Value)); ok {
+				return BooleanLiteral{Value: cmp, span: span}, nil
+			}
+		}
+	}
+
+	return nil, mismatch(e, left, right)
+}
+
+func foldInt(e BinaryExpression, l, r int64) (Expression, error) {
+	span := e.Span()
+
+	switch e.Op {
+	case "+":
+		return IntegerLiteral{Value: l + r, span: span}, nil
+	case "-":
+		return IntegerLiteral{Value: l - r, span: span}, nil
+	case "*":
+		return IntegerLiteral{Value: l * r, span: span}, nil
+	case "/":
+		if r == 0 {
+			return nil, diag.Errorf(diag.CodeDivisionByZero, span, "division by zero")
+		}
+		return IntegerLiteral{Value: l / r, span: span}, nil
+	}
+
+	cmp := 0
+	if l < r {
+		cmp = -1
+	} else if l > r {
+		cmp = 1
+	}
+
+	if val, ok := compareOp(e.Op, cmp); ok {
+		return BooleanLiteral{Value: val, span: span}, nil
+	}
+
+	return nil, mismatch(e, IntegerLiteral{}, IntegerLiteral{})
+}
+
+func foldFloat(e BinaryExpression, l, r float64) (Expression, error) {
+	span := e.Span()
+
+	switch e.Op {
+	case "+":
+		return FloatLiteral{Value: l + r, span: span}, nil
+	case "-":
+		return FloatLiteral{Value: l - r, span: span}, nil
+	case "*":
+		return FloatLiteral{Value: l * r, span: span}, nil
+	case "/":
+		if r == 0 {
+			return nil, diag.Errorf(diag.CodeDivisionByZero, span, "division by zero")
+		}
+		return FloatLiteral{Value: l / r, span: span}, nil
+	case "<":
+		return BooleanLiteral{Value: l < r, span: span}, nil
+	case ">":
+		return BooleanLiteral{Value: l > r, span: span}, nil
+	case "<=":
+		return BooleanLiteral{Value: l <= r, span: span}, nil
+	case ">=":
+		return BooleanLiteral{Value: l >= r, span: span}, nil
+	case "==":
+		return BooleanLiteral{Value: l == r, span: span}, nil
+	case "!=":
+		return BooleanLiteral{Value: l != r, span: span}, nil
+	}
+
+	return nil, mismatch(e, FloatLiteral{}, FloatLiteral{})
+}
+
+// compareOp applies a comparison operator to the result of comparing two values,
+// which is negative if the left value is less than the right one, zero if they are equal and positive otherwise.
+// ok is false if op is not a comparison.
+func compareOp(op string, cmp int) (val bool, ok bool) {
+	switch op {
+	case "<":
+		return cmp < 0, true
+	case ">":
+		return cmp > 0, true
+	case "<=":
+		return cmp <= 0, true
+	case ">=":
+		return cmp >= 0, true
+	case "==":
+		return cmp == 0, true
+	case "!=":
+		return cmp != 0, true
+	}
+
+	return false, false
+}
+
+func mismatch(e BinaryExpression, left, right Expression) error {
+	return diag.Errorf(diag.CodeTypeMismatch, e.Span(), "operator %s cannot be used with %v and %v", e.Op, left.ReturnType(), right.ReturnType())
+}
@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"fmt"
+	"leoscript/diag"
+	"leoscript/token"
+	"leoscript/types"
+)
+
+// withType gives the expression the type t that its value is expected to have.
+// An int is promoted to float, and a list literal takes the type t if its type could not be inferred
+// from its elements, like [], or if its elements are promoted, like [1, 2] for []float.
+// Other expressions are returned as they are.
+func withType(expr Expression, t types.Type) Expression {
+	if t == types.Float && expr.ReturnType() == types.Int {
+		return toFloat(expr)
+	}
+
+	lit, ok := expr.(ListLiteral)
+	if !ok || (lit.listType != nil && !promotes(lit.listType, t)) {
+		return expr
+	}
+
+	listType, ok := t.(*types.ListType)
+	if !ok {
+		return expr
+	}
+
+	lit.listType = listType
+	for i, elem := range lit.Elems {
+		lit.Elems[i] = withType(elem, listType.Elem)
+	}
+
+	return lit
+}
+
+// withTypes applies withType to the arguments of a call with the given parameter types.
+func withTypes(args []Expression, params []types.Type) {
+	for i := range min(len(args), len(params)) {
+		args[i] = withType(args[i], params[i])
+	}
+}
+
+// promotes reports whether values of type from are promoted to type to, like int to float,
+// or []int to []float for list literals.
+func promotes(from, to types.Type) bool {
+	if from == types.Int && to == types.Float {
+		return true
+	}
+
+	fromList, ok := from.(*types.ListType)
+	if !ok {
+		return false
+	}
+	toList, ok := to.(*types.ListType)
+	return ok && promotes(fromList.Elem, toList.Elem)
+}
+
+// toFloat converts an int expression to float. Int literals are converted directly, so that they stay constant.
+func toFloat(expr Expression) Expression {
+	if lit, ok := expr.(IntegerLiteral); ok {
+		return FloatLiteral{Value: float64(lit.Value), span: lit.span}
+	}
+
+	return BuiltinCall{
+		Name:       "float",
+		Args:       []Expression{expr},
+		returnType: types.Float,
+		span:       expr.Span(),
+	}
+}
+
+// parseConversion parses the conversion of a number to int or float, like int(x), starting at the type.
+// A float is converted to int by discarding its fraction.
+func (p *Parser) parseConversion() (Expression, error) {
+	typeTk := p.peek().(token.Type)
+	if typeTk.Kind != types.Int && typeTk.Kind != types.Float {
+		return nil, diag.Errorf(diag.CodeTypeMismatch, typeTk.Span(), "cannot convert to %v, only to %v and %v", typeTk.Kind, types.Int, types.Float)
+	}
+
+	if err := p.expect(token.OpenParenType); err != nil {
+		return nil, fmt.Errorf("expected open parenthesis after conversion: %w", err)
+	}
+
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse arguments: %w", err)
+	}
+
+	if err := p.expect(token.CloseParenType); err != nil {
+		return nil, fmt.Errorf("expected close parenthesis after conversion: %w", err)
+	}
+
+	call := BuiltinCall{
+		Args:       args,
+		returnType: typeTk.Kind,
+		span:       typeTk.Span().Join(p.peek().Span()),
+	}
+
+	call.Name = "int"
+	if typeTk.Kind == types.Float {
+		call.Name = "float"
+	}
+
+	return call, nil
+}
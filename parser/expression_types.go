@@ -7,28 +7,54 @@ import (
 
 type Expression interface {
 	ReturnType() types.Type
+	// Span is the location in the source that the expression was parsed from.
+	Span() token.Span
 }
 
 type IntegerLiteral struct {
-	Value int
+	Value int64
+	span  token.Span
 }
 
 func (IntegerLiteral) ReturnType() types.Type { return types.Int }
 
+func (e IntegerLiteral) Span() token.Span { return e.span }
+
+type FloatLiteral struct {
+	Value float64
+	span  token.Span
+}
+
+func (FloatLiteral) ReturnType() types.Type { return types.Float }
+
+func (e FloatLiteral) Span() token.Span { return e.span }
+
 type BooleanLiteral struct {
 	Value bool
+	span  token.Span
 }
 
 func (BooleanLiteral) ReturnType() types.Type { return types.Bool }
 
+func (e BooleanLiteral) Span() token.Span { return e.span }
+
+type StringLiteral struct {
+	Value string
+	span  token.Span
+}
+
+func (StringLiteral) ReturnType() types.Type { return types.String }
+
+func (e StringLiteral) Span() token.Span { return e.span }
+
 type BinaryExpression struct {
-	Left     Expression
-	Right    Expression
-	Op       string
-	priority token.Priority
+	Left  Expression
+	Right Expression
+	Op    string
 }
 
-// Note: Will not support other number types than int with the current setup.
+// The operand types are checked when the expression is evaluated.
+// In arithmetic an int operand is promoted to float if the other operand is a float.
 func (e BinaryExpression) ReturnType() types.Type {
 	if e.Op == "&&" || e.Op == "||" {
 		return types.Bool
@@ -42,61 +68,43 @@ func (e BinaryExpression) ReturnType() types.Type {
 		return types.Bool
 	}
 
+	// + concatenates strings
+	if e.Op == "+" && e.Left.ReturnType() == types.String {
+		return types.String
+	}
+
 	if e.Op == "+" || e.Op == "-" || e.Op == "*" || e.Op == "/" {
+		if e.Left.ReturnType() == types.Float || e.Right.ReturnType() == types.Float {
+			return types.Float
+		}
 		return types.Int
 	}
 
 	panic("unknown binary expression type")
 }
 
-// PriorityMerge will merge the current binary expression with a new expression based on the priorities of the operators
-// A new expression tree will be returned with the order of operations handled correctly.
-func (root BinaryExpression) PriorityMerge(binTk token.Operator, newExpr Expression) Expression {
-	priority := binTk.Priority()
-
-	// If the new priority is lower, it should be higher in the expression tree to be evaluated later.
-	// If it is the same, it should also be higher to preserve left-to-right evaluation.
-	if priority <= root.priority {
-		// No priority swap needed, create a new root expression
-		return BinaryExpression{
-			Left:     root,
-			Right:    newExpr,
-			Op:       binTk.Op,
-			priority: priority,
-		}
-	}
-
-	// The right side of the root binary expression is also a binary expression
-	// We need to also do a priority merge on that to support multiple layers of priority
-	if rbin, ok := root.Right.(BinaryExpression); ok {
-		root.Right = rbin.PriorityMerge(binTk, newExpr)
-		return root
-	}
-
-	// We have a higher priority operator, so we need to swap the root right side
-	newRight := BinaryExpression{
-		Left:     root.Right,
-		Right:    newExpr,
-		Op:       binTk.Op,
-		priority: priority,
-	}
-	root.Right = newRight
-
-	return root
+func (e BinaryExpression) Span() token.Span {
+	return e.Left.Span().Join(e.Right.Span())
 }
 
 type UnaryExpression struct {
 	Expression Expression
 	Op         string
+	span       token.Span
 }
 
 func (e UnaryExpression) ReturnType() types.Type { return e.Expression.ReturnType() }
 
+func (e UnaryExpression) Span() token.Span { return e.span.Join(e.Expression.Span()) }
+
 type Identifier struct {
 	Name       string
 	returnType types.Type
+	span       token.Span
 }
 
+func (i Identifier) Span() token.Span { return i.span }
+
 func (i Identifier) ReturnType() types.Type {
 	if i.returnType == nil {
 		panic("return type not set")
@@ -106,15 +114,86 @@ func (i Identifier) ReturnType() types.Type {
 }
 
 type Call struct {
-	Name       string
+	Name string
+	// Callee is the called function value when it is not named, like the function returned by another call.
+	// Name is empty then.
+	Callee     Expression
 	Args       []Expression
 	returnType types.Type
+	span       token.Span
 }
 
+func (c Call) Span() token.Span { return c.span }
+
 func (c Call) ReturnType() types.Type {
 	if c.returnType == nil {
 		panic("return type not set")
 	}
 
-	return types.Void
+	return c.returnType
+}
+
+// FnLiteral is an anonymous function. Evaluating it gives a closure over the scope it is evaluated in.
+type FnLiteral struct {
+	Fn FnDef
+}
+
+func (e FnLiteral) ReturnType() types.Type { return e.Fn.Type() }
+
+func (e FnLiteral) Span() token.Span { return e.Fn.Span() }
+
+// ListLiteral is a list of elements like [1, 2, 3]. Its type is inferred from the first element.
+type ListLiteral struct {
+	Elems []Expression
+	// listType is nil for an empty literal whose type could not be inferred from where it is used.
+	listType *types.ListType
+	span     token.Span
+}
+
+func (e ListLiteral) ReturnType() types.Type {
+	if e.listType == nil {
+		return nil
+	}
+
+	return e.listType
+}
+
+func (e ListLiteral) Span() token.Span { return e.span }
+
+// IndexExpression is the element of a list at an index, like a[i].
+type IndexExpression struct {
+	List  Expression
+	Index Expression
+	span  token.Span
 }
+
+func (e IndexExpression) ReturnType() types.Type { return e.List.ReturnType().(*types.ListType).Elem }
+
+func (e IndexExpression) Span() token.Span { return e.span }
+
+// SliceExpression is the part of a list between two indexes, like a[1:3].
+// The resulting list shares its elements with the sliced one.
+type SliceExpression struct {
+	List Expression
+	// Low and High are nil when left out, they default to the start and the end of the list.
+	Low  Expression
+	High Expression
+	span token.Span
+}
+
+func (e SliceExpression) ReturnType() types.Type { return e.List.ReturnType() }
+
+func (e SliceExpression) Span() token.Span { return e.span }
+
+// BuiltinCall is a call of a builtin function like len or append, which work with lists of any type
+// and cannot be expressed as a function value.
+type BuiltinCall struct {
+	Name       string
+	Args       []Expression
+	returnType types.Type
+	span       token.Span
+}
+
+func (c BuiltinCall) ReturnType() types.Type { return c.returnType }
+
+func (c BuiltinCall) Span() token.Span { return c.span }
@@ -1,51 +1,52 @@
 package parser
 
 import (
-	"errors"
 	"fmt"
+	"leoscript/diag"
 	"leoscript/token"
+	"leoscript/types"
 )
 
+// ParseExpr parses the expression starting at the current token.
+// The parser is left on the last token of the expression, which must be followed by
+// a semicolon, a close-paren, a comma, a close-bracket or a colon that is left for the parent to verify.
 func (p *Parser) ParseExpr() (Expression, error) {
-	// Parse the first part in the expression.
-	// This will be the root of the expression tree.
-	root, err := p.parsePrimaryExpression()
+	expr, err := p.parseExprPriority(0)
 	if err != nil {
 		return nil, err
 	}
 
-	for tk := p.next(); tk != nil; tk = p.next() {
-		switch tk := tk.(type) {
-		case token.Semicolon:
-			p.putBack() // put the semicolon back, it might be used to end the parent
-			return root, nil
-
-		case token.OpenParen:
-			expr, err := p.handleSubgroup()
-			if err != nil {
-				return nil, err
-			}
-
-			root = expr
-
-		case token.CloseParen:
-			p.putBack() // put the close-paren back, it will be verified by the parent
-			return root, nil
+	switch tk := p.next().(type) {
+	case token.Semicolon, token.CloseParen, token.Comma, token.CloseBracket, token.Colon:
+		p.putBack()
+		return expr, nil
+	default:
+		return nil, p.errorf("unexpected token in expression: %v", tk.Type())
+	}
+}
 
-		case token.Operator:
-			expr, err := p.parseBinaryExpr(root)
-			if err != nil {
-				return nil, err
-			}
+// parseExprPriority parses an operand followed by every binary operator that binds tighter than minPriority.
+// Operators binding less tightly are left for the caller, which is how the order of operations is handled:
+// in 1 + 2 * 3 the right operand of + is parsed with the priority of +, so it takes 2 * 3 with it.
+func (p *Parser) parseExprPriority(minPriority token.Priority) (Expression, error) {
+	left, err := p.parsePrimaryExpression()
+	if err != nil {
+		return nil, err
+	}
 
-			root = expr
+	for {
+		// Assignments are statements, so an assignment operator ends the expression
+		binTk, ok := p.peekNext().(token.Operator)
+		if !ok || binTk.Priority() <= minPriority || binTk.Priority() == token.PRIO_ASSIGN {
+			return left, nil
+		}
 
-		default:
-			return nil, fmt.Errorf("unexpected token in expression: T=%T V=%v", tk, tk)
+		p.next() // move to the operator token
+		left, err = p.parseBinaryExpr(left)
+		if err != nil {
+			return nil, err
 		}
 	}
-
-	return nil, errors.New("reached EOF without completing the expression")
 }
 
 func (p *Parser) handleSubgroup() (Expression, error) {
@@ -55,12 +56,6 @@ func (p *Parser) handleSubgroup() (Expression, error) {
 		return nil, fmt.Errorf("failed to parse expression: %w", err)
 	}
 
-	// If the expression is a binary expression, set the priority to the max so that it is never reordered
-	if binExpr, ok := expr.(BinaryExpression); ok {
-		binExpr.priority = token.PRIO_PAREN
-		expr = binExpr
-	}
-
 	if err := p.expect(token.CloseParenType); err != nil {
 		return nil, fmt.Errorf("failed to parse expression: %w", err)
 	}
@@ -68,16 +63,61 @@ func (p *Parser) handleSubgroup() (Expression, error) {
 	return expr, nil
 }
 
+// parsePrimaryExpression parses an operand, including the calls of the function it results in, like f()(1),
+// and the indexes and slices of the list it results in, like a[1][2:].
 func (p *Parser) parsePrimaryExpression() (Expression, error) {
+	expr, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch p.peekNext().(type) {
+		case token.OpenParen:
+			fnType, ok := expr.ReturnType().(*types.FuncType)
+			if !ok {
+				return expr, nil
+			}
+
+			p.next() // Move to the open parenthesis
+			expr, err = p.parseValueCall(expr, fnType)
+
+		case token.OpenBracket:
+			p.next() // Move to the open bracket
+			expr, err = p.parseIndex(expr)
+
+		default:
+			return expr, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *Parser) parseOperand() (Expression, error) {
 	switch tk := p.peek().(type) {
 	case token.Integer:
-		return IntegerLiteral{Value: tk.Value}, nil
+		return IntegerLiteral{Value: tk.Value, span: tk.Span()}, nil
+	case token.Float:
+		return FloatLiteral{Value: tk.Value, span: tk.Span()}, nil
 	case token.Boolean:
-		return BooleanLiteral{Value: tk.Value}, nil
+		return BooleanLiteral{Value: tk.Value, span: tk.Span()}, nil
+	case token.String:
+		return StringLiteral{Value: tk.Value, span: tk.Span()}, nil
 	case token.Operator:
 		return p.parseUnaryExpr()
 	case token.OpenParen:
 		return p.handleSubgroup()
+	case token.FnDef:
+		return p.parseFnLiteral()
+	case token.OpenBracket:
+		return p.parseListLiteral()
+	case token.Type:
+		if p.peekNext().Type() == token.OpenParenType {
+			return p.parseConversion()
+		}
 	case token.Identifier:
 		if p.peekNext().Type() == token.OpenParenType {
 			return p.parseFnCall()
@@ -86,26 +126,74 @@ func (p *Parser) parsePrimaryExpression() (Expression, error) {
 		return p.parseIdentifier()
 	}
 
-	return nil, fmt.Errorf("unexpected token in primary expression: T=%T V=%v", p.peek(), p.peek())
+	return nil, p.errorf("unexpected token in primary expression: %v", p.peek().Type())
 }
 
 func (p *Parser) parseIdentifier() (Expression, error) {
-	identifier := p.peek().(token.Identifier)
+	identifier, err := p.resolveIdentifier(p.peek().(token.Identifier))
+	if err != nil {
+		return nil, err
+	}
+
+	return identifier, nil
+}
 
+// resolveIdentifier returns the use of the variable named by the identifier.
+// A function used by name, and not called, is a function value.
+func (p *Parser) resolveIdentifier(identifier token.Identifier) (Identifier, error) {
 	varDecl, ok := p.scope.ResolveVar(identifier.Value)
 	if !ok {
-		return nil, fmt.Errorf("undeclared variable: %s", identifier.Value)
+		if fn, ok := p.scope.ResolveFn(identifier.Value); ok {
+			p.useFn(identifier.Value, identifier.Span())
+			return Identifier{Name: identifier.Value, returnType: fn.Type(), span: identifier.Span()}, nil
+		}
+		if decl, ok := p.uninitialized[identifier.Value]; ok {
+			return Identifier{}, p.uninitializedErr(decl, identifier.Span())
+		}
+		return Identifier{}, diag.Errorf(diag.CodeUndeclared, identifier.Span(), "undeclared variable: %s", identifier.Value)
+	}
+	p.useVar(identifier.Value, identifier.Span())
+
+	return Identifier{Name: identifier.Value, returnType: varDecl.Type, span: identifier.Span()}, nil
+}
+
+// parseCallStmt parses a call used as a statement, its result is discarded.
+// Builtin functions have no side effects, so their results cannot be discarded,
+// and neither can the elements of lists returned by calls.
+func (p *Parser) parseCallStmt() (Statement, error) {
+	expr, err := p.parsePrimaryExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	call, ok := expr.(Call)
+	if !ok {
+		return nil, errorAt(expr.Span(), "the value of the expression is not used")
 	}
 
-	return Identifier{Name: identifier.Value, returnType: varDecl.Type}, nil
+	return call, nil
 }
 
+// parseFnCall parses the call of a variable holding a function or of a function by name.
+// Variables are resolved first, like in resolveIdentifier, so that a parameter holding a callback
+// shadows a function of the same name. Builtin functions are called when neither is declared.
 func (p *Parser) parseFnCall() (Expression, error) {
 	identifier := p.peek().(token.Identifier)
 
-	funcDef, ok := p.scope.ResolveFn(identifier.Value)
-	if !ok {
-		return nil, fmt.Errorf("undeclared function: %s", identifier.Value)
+	var fnType *types.FuncType
+	if varDecl, ok := p.scope.ResolveVar(identifier.Value); ok {
+		fnType, ok = varDecl.Type.(*types.FuncType)
+		if !ok {
+			return nil, diag.Errorf(diag.CodeTypeMismatch, identifier.Span(), "%s is not a function, it is %v", identifier.Value, varDecl.Type)
+		}
+		p.useVar(identifier.Value, identifier.Span())
+	} else if funcDef, ok := p.scope.ResolveFn(identifier.Value); ok {
+		p.useFn(identifier.Value, identifier.Span())
+		fnType = funcDef.Type().(*types.FuncType)
+	} else if builtins[identifier.Value] {
+		return p.parseBuiltinCall()
+	} else {
+		return nil, diag.Errorf(diag.CodeUndeclared, identifier.Span(), "undeclared function: %s", identifier.Value)
 	}
 
 	if err := p.expect(token.OpenParenType); err != nil {
@@ -120,11 +208,91 @@ func (p *Parser) parseFnCall() (Expression, error) {
 	if err := p.expect(token.CloseParenType); err != nil {
 		return nil, fmt.Errorf("expected close parenthesis after function call: %w", err)
 	}
+	withTypes(args, fnType.Params)
 
-	return Call{
+	call := Call{
 		Name:       identifier.Value,
 		Args:       args,
-		returnType: funcDef.ReturnType,
+		returnType: fnType.Return,
+		span:       identifier.Span().Join(p.peek().Span()),
+	}
+
+	return call, nil
+}
+
+// parseValueCall parses the call of the function value that callee results in, starting at the open parenthesis.
+func (p *Parser) parseValueCall(callee Expression, fnType *types.FuncType) (Expression, error) {
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse arguments: %w", err)
+	}
+
+	if err := p.expect(token.CloseParenType); err != nil {
+		return nil, fmt.Errorf("expected close parenthesis after function call: %w", err)
+	}
+	withTypes(args, fnType.Params)
+
+	return Call{
+		Callee:     callee,
+		Args:       args,
+		returnType: fnType.Return,
+		span:       callee.Span().Join(p.peek().Span()),
+	}, nil
+}
+
+// parseFnLiteral parses an anonymous function starting at the current fn token.
+// Its body is parsed right away in a scope under the current one, which the function closes over.
+// The parser is left on the closing brace of the body.
+func (p *Parser) parseFnLiteral() (Expression, error) {
+	fnTk := p.peek()
+
+	if err := p.expect(token.OpenParenType); err != nil {
+		return nil, fmt.Errorf("expected open parenthesis after fn: %w", err)
+	}
+
+	args, err := p.parseFnParams()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse arguments: %w", err)
+	}
+
+	if err := p.expect(token.CloseParenType); err != nil {
+		return nil, fmt.Errorf("expected close parenthesis after arguments: %w", err)
+	}
+
+	returnType, err := p.parseReturnType()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expect(token.OpenBraceType); err != nil {
+		return nil, fmt.Errorf("expected open brace after arguments in function literal: %w", err)
+	}
+
+	p.next() // Consume the open brace
+
+	// Loops around the literal do not continue inside its body
+	parentScope, loopDepth, parentReturnType := p.scope, p.loopDepth, p.returnType
+	p.scope, p.loopDepth, p.returnType = NewScope(parentScope), 0, returnType
+	defer func() { p.scope, p.loopDepth, p.returnType = parentScope, loopDepth, parentReturnType }()
+
+	for _, arg := range args {
+		if err := p.scope.RegisterVar(VarDecl{Name: arg.Name, Type: arg.Type}); err != nil {
+			return nil, diag.Errorf(diag.CodeRedeclared, fnTk.Span(), "%v", err)
+		}
+	}
+
+	errs := len(p.diags)
+	body := p.parseBlock()
+
+	return FnLiteral{
+		Fn: FnDef{
+			Name:       "anonymous function",
+			ReturnType: returnType,
+			Args:       args,
+			Body:       body,
+			incomplete: p.diags[errs:].HasErrors(),
+			span:       fnTk.Span().Join(p.peek().Span()),
+		},
 	}, nil
 }
 
@@ -135,6 +303,8 @@ func (p *Parser) parseArgs() ([]Expression, error) {
 
 	args := make([]Expression, 0)
 	for {
+		p.next() // Move past the open parenthesis or comma
+
 		expr, err := p.ParseExpr()
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse argument: %w", err)
@@ -160,7 +330,7 @@ func (p *Parser) parseUnaryExpr() (Expression, error) {
 	switch binTk.Op {
 	case "-", "+", "!":
 		p.next() // consume the operator token
-		expr, err := p.parsePrimaryExpression()
+		expr, err := p.parseExprPriority(token.PRIO_PREFIX)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse right hand expression: %w", err)
 		}
@@ -168,32 +338,54 @@ func (p *Parser) parseUnaryExpr() (Expression, error) {
 		return UnaryExpression{
 			Expression: expr,
 			Op:         binTk.Op,
+			span:       binTk.Span(),
+		}, nil
+
+	case "--", "++":
+		// The lexer reads the signs of --x as the decrement operator, in an expression they are two prefix operators
+		p.next() // consume the operator token
+		expr, err := p.parseExprPriority(token.PRIO_PREFIX)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse right hand expression: %w", err)
+		}
+
+		span := binTk.Span()
+		op := binTk.Op[:1]
+		return UnaryExpression{
+			Expression: UnaryExpression{
+				Expression: expr,
+				Op:         op,
+				span:       token.Span{Start: span.End, End: span.End},
+			},
+			Op:   op,
+			span: token.Span{Start: span.Start, End: span.Start},
 		}, nil
 
 	default:
-		return nil, fmt.Errorf("unexpected operator in unary expression: %v", binTk)
+		return nil, p.errorf("unexpected operator in unary expression: %v", binTk.Op)
 	}
 }
 
-func (p *Parser) parseBinaryExpr(root Expression) (Expression, error) {
+// parseBinaryExpr parses the right operand of the operator at the current token.
+// A left-associative operator stops the right operand at operators of its own priority so that they group
+// from the left, a right-associative one lets the right operand take them.
+func (p *Parser) parseBinaryExpr(left Expression) (Expression, error) {
 	binTk := p.peek().(token.Operator)
 
+	minPriority := binTk.Priority()
+	if binTk.Associativity() == token.RightAssoc {
+		minPriority--
+	}
+
 	p.next() // consume the operator token
-	right, err := p.parsePrimaryExpression()
+	right, err := p.parseExprPriority(minPriority)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse right expression: %w", err)
 	}
 
-	// Do a right swap if the priority of the current operator is higher
-	if rootBinExpr, ok := root.(BinaryExpression); ok {
-		return rootBinExpr.PriorityMerge(binTk, right), nil
-	}
-
-	// Left side was not a binary expression.
 	return BinaryExpression{
-		Left:     root,
-		Right:    right,
-		Op:       binTk.Op,
-		priority: binTk.Priority(),
+		Left:  left,
+		Right: right,
+		Op:    binTk.Op,
 	}, nil
 }
@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"fmt"
+	"leoscript/diag"
+	"leoscript/token"
+)
+
+// use is a reference to a top-level variable or function.
+type use struct {
+	name string
+	span token.Span
+}
+
+// uses records the top-level variables and functions that a function body or the value of a
+// top-level variable refers to, in source order. It is used to check the order of initialization.
+type uses struct {
+	vars []use
+	fns  []use
+}
+
+// parseGlobalVarDecl parses a top-level variable declaration.
+// The tokens of the value are kept to be parsed once all functions of the file are known,
+// the parser is left on the terminating semicolon.
+func (p *Parser) parseGlobalVarDecl() (VarDecl, error) {
+	decl, err := p.parseVarDeclHeader()
+	if err != nil {
+		return VarDecl{}, err
+	}
+
+	depth := 0
+	for tk := p.next(); ; tk = p.next() {
+		switch tk.(type) {
+		case token.OpenParen, token.OpenBrace:
+			depth++
+		case token.CloseParen, token.CloseBrace:
+			depth--
+		case token.EOF:
+			return VarDecl{}, errorAt(tk.Span(), "unexpected EOF, expected semicolon after variable declaration")
+		}
+
+		decl.valueSrc = append(decl.valueSrc, tk)
+
+		if _, ok := tk.(token.Semicolon); ok && depth <= 0 {
+			break
+		}
+	}
+
+	decl.span = decl.span.Join(p.peek().Span())
+	return decl, nil
+}
+
+// declareGlobalVar parses a top-level variable declaration and adds it to the variables to initialize.
+// ok is false if the declaration is to be left out of the program because of an error, which has been reported.
+func (p *Parser) declareGlobalVar(uninitialized map[string]VarDecl) (decl VarDecl, ok bool) {
+	decl, err := p.parseGlobalVarDecl()
+	if err != nil {
+		p.report(err)
+		p.synchronize(false)
+		return VarDecl{}, false
+	}
+
+	if prev, ok := uninitialized[decl.Name]; ok {
+		p.diags.Add(diag.Errorf(diag.CodeRedeclared, decl.Span(), "variable %s already declared", decl.Name).
+			WithNote(prev.Span(), "previous declaration of %s", prev.Name))
+		return VarDecl{}, false
+	}
+
+	uninitialized[decl.Name] = decl
+	return decl, true
+}
+
+// parseValue parses the value of a top-level variable in the global scope s.
+// uninitialized holds the variables declared after this one, which the value cannot use.
+func (decl VarDecl) parseValue(s *Scope, uninitialized map[string]VarDecl) (VarDecl, error) {
+	p := Parser{
+		tokens:        decl.valueSrc,
+		scope:         s,
+		globals:       s,
+		uses:          &uses{},
+		uninitialized: uninitialized,
+		initializing:  decl.Name,
+	}
+
+	expr, err := p.ParseExpr()
+	if err != nil {
+		return decl, fmt.Errorf("failed to parse right hand expression: %w", err)
+	}
+
+	if err := p.expect(token.SemicolonType); err != nil {
+		return decl, fmt.Errorf("expected semicolon after identifier: %w", err)
+	}
+
+	if decl.Const {
+		if expr, err = p.constValue(expr); err != nil {
+			return decl, err
+		}
+	}
+
+	// If no type is specified, use the type of the expression
+	decl, err = decl.inferType(expr)
+	if err != nil {
+		return decl, err
+	}
+
+	decl.valueSrc = nil
+	decl.uses = p.uses
+
+	return decl, nil
+}
+
+// uninitializedErr returns the error for a use of a top-level variable in the value of a variable
+// declared before it, or in its own value.
+func (p *Parser) uninitializedErr(decl VarDecl, span token.Span) error {
+	if decl.Name == p.initializing {
+		return diag.Errorf(diag.CodeInitCycle, span, "initialization of %s refers to itself", decl.Name)
+	}
+
+	return diag.Errorf(diag.CodeInitOrder, span, "%s is used before it is initialized", decl.Name).
+		WithNote(decl.Span(), "%s is declared here", decl.Name)
+}
+
+// useVar records the use of a variable if it is a top-level one.
+func (p *Parser) useVar(name string, span token.Span) {
+	if p.uses == nil {
+		return
+	}
+
+	if _, s, ok := p.scope.lookupVar(name); ok && s == p.globals {
+		p.uses.vars = append(p.uses.vars, use{name: name, span: span})
+	}
+}
+
+// useFn records the call of a function if it is declared in the file.
+func (p *Parser) useFn(name string, span token.Span) {
+	if p.uses == nil {
+		return
+	}
+
+	if _, ok := p.globals.fnDefs[name]; ok {
+		p.uses.fns = append(p.uses.fns, use{name: name, span: span})
+	}
+}
+
+// checkInitOrder reports the top-level variables whose values call functions that use, directly
+// or through other calls, the variable itself or variables declared after it.
+// Uses written directly in the values are reported while parsing them.
+func (p *Parser) checkInitOrder() {
+	fns := make(map[string]FnDef)
+	order := make(map[string]int)
+	for i, stmt := range p.Program.Body {
+		switch s := stmt.(type) {
+		case FnDef:
+			fns[s.Name] = s
+		case VarDecl:
+			order[s.Name] = i
+		}
+	}
+
+	for i, stmt := range p.Program.Body {
+		decl, ok := stmt.(VarDecl)
+		if !ok || decl.uses == nil {
+			continue
+		}
+
+		uninitialized := func(name string) bool {
+			j, ok := order[name]
+			return ok && j >= i
+		}
+
+		for _, call := range decl.uses.fns {
+			fn, u, ok := uninitializedUse(fns, call.name, make(map[string]bool), uninitialized)
+			if !ok {
+				continue
+			}
+
+			var d diag.Diagnostic
+			if u.name == decl.Name {
+				d = diag.Errorf(diag.CodeInitCycle, call.span, "initialization of %s refers to itself through %s", decl.Name, call.name)
+			} else {
+				d = diag.Errorf(diag.CodeInitOrder, call.span, "%s uses %s before it is initialized", call.name, u.name)
+			}
+			p.diags.Add(d.WithNote(u.span, "%s is used by %s here", u.name, fn.Name))
+
+			// One error is enough for each variable
+			break
+		}
+	}
+}
+
+// uninitializedUse searches the function with the given name and the functions it calls for the use of
+// an uninitialized variable. It returns the function using the variable and the use.
+func uninitializedUse(fns map[string]FnDef, name string, visited map[string]bool, uninitialized func(string) bool) (FnDef, use, bool) {
+	fn, ok := fns[name]
+	if !ok || visited[name] || fn.uses == nil {
+		return FnDef{}, use{}, false
+	}
+	visited[name] = true
+
+	for _, u := range fn.uses.vars {
+		if uninitialized(u.name) {
+			return fn, u, true
+		}
+	}
+
+	for _, call := range fn.uses.fns {
+		if fn, u, ok := uninitializedUse(fns, call.name, visited, uninitialized); ok {
+			return fn, u, true
+		}
+	}
+
+	return FnDef{}, use{}, false
+}
@@ -0,0 +1,239 @@
+package parser
+
+import (
+	"fmt"
+	"leoscript/diag"
+	"leoscript/token"
+	"leoscript/types"
+)
+
+// builtins are the functions available to every script that cannot be declared in LeoScript itself,
+// because they work with lists of any element type. Declared functions and variables take precedence.
+var builtins = map[string]bool{
+	// len(list) int returns the number of elements of a list.
+	"len": true,
+	// append(list, elems...) returns the list with the elements added to its end.
+	"append": true,
+}
+
+// parseListLiteral parses a list literal starting at the current open bracket.
+// The type of the list is inferred from the first element whose type is known.
+// The parser is left on the closing bracket.
+func (p *Parser) parseListLiteral() (Expression, error) {
+	openTk := p.peek()
+
+	elems := []Expression{}
+	for p.peekNext().Type() != token.CloseBracketType {
+		if len(elems) > 0 {
+			if err := p.expect(token.CommaType); err != nil {
+				return nil, fmt.Errorf("expected comma between list elements: %w", err)
+			}
+		}
+
+		p.next() // Move to the element
+		elem, err := p.ParseExpr()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse list element: %w", err)
+		}
+		elems = append(elems, elem)
+	}
+
+	p.next() // Move to the close bracket
+
+	lit := ListLiteral{Elems: elems, span: openTk.Span().Join(p.peek().Span())}
+	for _, elem := range elems {
+		if t := elem.ReturnType(); t != nil {
+			return withType(lit, types.List(t)), nil
+		}
+	}
+
+	return lit, nil
+}
+
+// parseIndex parses the index or slice of the list, starting at the open bracket following it.
+// The parser is left on the closing bracket.
+func (p *Parser) parseIndex(list Expression) (Expression, error) {
+	if _, ok := list.ReturnType().(*types.ListType); !ok {
+		return nil, diag.Errorf(diag.CodeTypeMismatch, list.Span(), "cannot index %v", list.ReturnType())
+	}
+
+	var low Expression
+	if p.peekNext().Type() != token.ColonType {
+		p.next() // Move to the index
+		index, err := p.ParseExpr()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse index: %w", err)
+		}
+		low = index
+	}
+
+	if p.peekNext().Type() != token.ColonType {
+		if err := p.expect(token.CloseBracketType); err != nil {
+			return nil, fmt.Errorf("expected close bracket after index: %w", err)
+		}
+
+		return IndexExpression{
+			List:  list,
+			Index: low,
+			span:  list.Span().Join(p.peek().Span()),
+		}, nil
+	}
+
+	p.next() // Move to the colon
+
+	var high Expression
+	if p.peekNext().Type() != token.CloseBracketType {
+		p.next() // Move to the end index
+		index, err := p.ParseExpr()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse end index: %w", err)
+		}
+		high = index
+	}
+
+	if err := p.expect(token.CloseBracketType); err != nil {
+		return nil, fmt.Errorf("expected close bracket after slice: %w", err)
+	}
+
+	return SliceExpression{
+		List: list,
+		Low:  low,
+		High: high,
+		span: list.Span().Join(p.peek().Span()),
+	}, nil
+}
+
+// parseIndexAssignment parses an assignment to an element of a list, like a[i] = v, starting at the list variable.
+// Compound assignments keep their operator, so that a[i] += v evaluates the list and the index once.
+// A call of a function held in a list, like a[i](), is parsed as a call statement.
+func (p *Parser) parseIndexAssignment() (Statement, error) {
+	expr, err := p.parsePrimaryExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	switch target := expr.(type) {
+	case Call:
+		return target, nil
+
+	case IndexExpression:
+		op, value, err := p.parseAssignOp(target)
+		if err != nil {
+			return nil, err
+		}
+
+		return IndexAssignment{
+			Target: target,
+			Op:     op,
+			Value:  value,
+			span:   target.Span().Join(value.Span()),
+		}, nil
+
+	default:
+		return nil, errorAt(expr.Span(), "cannot assign to a slice, only to variables and list elements")
+	}
+}
+
+// isForEach reports whether the for loop at the current open parenthesis iterates over a list,
+// like for (var x in list).
+func (p *Parser) isForEach() bool {
+	tk, _ := p.at(p.current + 3)
+	_, ok := tk.(token.In)
+	return ok
+}
+
+// parseForEach parses a loop over the elements of a list, starting at the open parenthesis following for.
+// The loop variable takes the element type of the list, and is visible only in the body.
+func (p *Parser) parseForEach(forTk token.Token) (Statement, error) {
+	if err := p.expect(token.VarDeclType); err != nil {
+		return nil, fmt.Errorf("expected var before the loop variable: %w", err)
+	}
+
+	identifier, err := p.expectName()
+	if err != nil {
+		return nil, fmt.Errorf("expected loop variable after var: %w", err)
+	}
+
+	if err := p.expect(token.InType); err != nil {
+		return nil, fmt.Errorf("expected in after loop variable: %w", err)
+	}
+
+	p.next() // Move to the list
+	list, err := p.ParseExpr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse list to loop over: %w", err)
+	}
+
+	if err := p.expect(token.CloseParenType); err != nil {
+		return nil, fmt.Errorf("expected close parenthesis after list to loop over: %w", err)
+	}
+
+	listType, ok := list.ReturnType().(*types.ListType)
+	if !ok {
+		return nil, diag.Errorf(diag.CodeTypeMismatch, list.Span(), "cannot loop over %v", list.ReturnType())
+	}
+
+	parentScope := p.scope
+	p.scope = NewScope(parentScope)
+	defer func() { p.scope = parentScope }()
+
+	decl := VarDecl{Name: identifier.Value, Type: listType.Elem, span: identifier.Span()}
+	p.scope.RegisterVar(decl)
+	p.checkShadowing(decl)
+
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse for body: %w", err)
+	}
+
+	return ForEach{
+		Var:  decl,
+		List: list,
+		Body: body,
+		span: forTk.Span().Join(p.peek().Span()),
+	}, nil
+}
+
+// parseBuiltinCall parses the call of a builtin function starting at its name.
+// The arguments are checked by the type checker, append only needs a list as its first argument
+// for its result to have a type.
+func (p *Parser) parseBuiltinCall() (Expression, error) {
+	identifier := p.peek().(token.Identifier)
+
+	if err := p.expect(token.OpenParenType); err != nil {
+		return nil, fmt.Errorf("expected open parenthesis after function call: %w", err)
+	}
+
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse arguments: %w", err)
+	}
+
+	if err := p.expect(token.CloseParenType); err != nil {
+		return nil, fmt.Errorf("expected close parenthesis after function call: %w", err)
+	}
+
+	call := BuiltinCall{
+		Name: identifier.Value,
+		Args: args,
+		span: identifier.Span().Join(p.peek().Span()),
+	}
+
+	switch call.Name {
+	case "len":
+		call.returnType = types.Int
+	case "append":
+		if len(args) == 0 {
+			return nil, diag.Errorf(diag.CodeArgumentCount, call.Span(), "append expects a list and the elements to append")
+		}
+
+		call.returnType = args[0].ReturnType()
+		if listType, ok := call.returnType.(*types.ListType); ok {
+			for i := 1; i < len(args); i++ {
+				args[i] = withType(args[i], listType.Elem)
+			}
+		}
+	}
+
+	return call, nil
+}
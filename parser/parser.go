@@ -1,11 +1,18 @@
 package parser
 
 import (
-	"fmt"
+	"errors"
+	"leoscript/diag"
 	"leoscript/token"
-	"slices"
+	"leoscript/types"
 )
 
+// TokenSource provides the tokens to parse one at a time. It returns token.EOF after the last token.
+// lexer.Lexer is a TokenSource.
+type TokenSource interface {
+	NextToken() token.Token
+}
+
 func NewParser(tokens []token.Token, scope *Scope) *Parser {
 	if scope == nil {
 		scope = NewScope(nil)
@@ -13,12 +20,48 @@ func NewParser(tokens []token.Token, scope *Scope) *Parser {
 	return &Parser{tokens: tokens, current: 0, scope: scope}
 }
 
+// NewStreamParser returns a parser that reads its tokens from src as they are needed
+// instead of requiring all of them up front.
+// Only the source text is streamed: ParseFile keeps the tokens of every function body and of every
+// top-level variable value until the end of the file, because they may refer to functions declared later.
+// The memory used by a file is therefore still proportional to its number of tokens.
+func NewStreamParser(src TokenSource, scope *Scope) *Parser {
+	p := NewParser(nil, scope)
+	p.src = src
+	return p
+}
+
+// keepBehind is the number of consumed tokens kept when reading from a TokenSource, so that they can be put back.
+const keepBehind = 4
+
 type Parser struct {
+	// tokens holds the tokens around the current one. When reading from src it is a window
+	// that is extended as needed, and consumed tokens are dropped from it.
 	tokens  []token.Token
 	current int
+	src     TokenSource
 
 	scope *Scope
 
+	// loopDepth is the number of loops enclosing the current statement, used to validate break and continue.
+	loopDepth int
+
+	// returnType is the return type of the function whose body is being parsed, the type of an empty list returned by it.
+	returnType types.Type
+
+	// globals is the scope of the top-level declarations of the file, and uses records the globals
+	// used by the function body or variable value being parsed, to check the order of initialization.
+	globals *Scope
+	uses    *uses
+
+	// uninitialized holds the top-level variables that cannot be used yet while parsing the value of
+	// the top-level variable named initializing, including the variable itself.
+	uninitialized map[string]VarDecl
+	initializing  string
+
+	// diags collects the problems found so far, parsing continues after errors to report as many as possible.
+	diags diag.Diagnostics
+
 	Program Program
 }
 
@@ -26,41 +69,147 @@ func (p *Parser) Scope() *Scope {
 	return p.scope
 }
 
+// Diagnostics returns all problems found by the parser, including warnings.
+func (p *Parser) Diagnostics() diag.Diagnostics {
+	return p.diags
+}
+
 // next will consume the current token and return the next one
 func (p *Parser) next() token.Token {
 	p.current++
 
-	if p.current >= len(p.tokens) {
+	// Drop the tokens that can no longer be put back
+	if p.src != nil && p.current >= 64 {
+		n := p.current - keepBehind
+		p.tokens = p.tokens[:copy(p.tokens, p.tokens[n:])]
+		p.current -= n
+	}
+
+	return p.peek()
+}
+
+// at returns the token at index i of the window, reading from the token source if needed.
+// ok is false past the last token.
+func (p *Parser) at(i int) (tk token.Token, ok bool) {
+	for i >= len(p.tokens) && p.src != nil {
+		tk := p.src.NextToken()
+		if tk.Type() == token.EOFType {
+			p.src = nil
+			break
+		}
+		p.tokens = append(p.tokens, tk)
+	}
+
+	if i >= len(p.tokens) {
+		return nil, false
+	}
+
+	return p.tokens[i], true
+}
+
+// eof returns an EOF token located right after the last token
+func (p *Parser) eof() token.Token {
+	if len(p.tokens) == 0 {
 		return token.EOF{}
 	}
 
-	return p.tokens[p.current]
+	end := p.tokens[len(p.tokens)-1].Span().End
+	return token.EOF{}.WithSpan(token.Span{Start: end, End: end})
+}
+
+// errorf returns a syntax error located at the current token
+func (p *Parser) errorf(format string, args ...any) error {
+	return errorAt(p.peek().Span(), format, args...)
+}
+
+// errorAt returns a syntax error located at the given span
+func errorAt(span token.Span, format string, args ...any) error {
+	return diag.Errorf(diag.CodeSyntax, span, format, args...)
+}
+
+// report records an error returned while parsing.
+// Errors without a position are located at the current token.
+func (p *Parser) report(err error) {
+	var d diag.Diagnostic
+	var ds diag.Diagnostics
+	if errors.As(err, &d) || errors.As(err, &ds) {
+		p.diags.AddError(err)
+		return
+	}
+
+	p.diags.Add(diag.Errorf(diag.CodeSyntax, p.peek().Span(), "%v", err))
+}
+
+// synchronize skips ahead to the end of the current statement after an error so that parsing can continue.
+// The parser is left on the terminating semicolon or closing brace, just like after a successfully parsed statement.
+// Inside a block, a closing brace that ends the block itself is left for the block to consume.
+func (p *Parser) synchronize(inBlock bool) {
+	depth := 0
+
+	for tk := p.peek(); tk.Type() != token.EOFType; tk = p.next() {
+		switch tk.(type) {
+		case token.OpenBrace:
+			depth++
+		case token.CloseBrace:
+			if depth == 0 {
+				if inBlock {
+					p.putBack()
+				}
+				return
+			}
+
+			depth--
+			if depth == 0 {
+				return
+			}
+		case token.Semicolon:
+			if depth == 0 {
+				return
+			}
+		}
+	}
 }
 
 // expect will return an error if the next token is not of the expected type
 func (p *Parser) expect(tk token.TokenType) error {
 	if tk != p.next().Type() {
-		return fmt.Errorf("expected token type %v, got %v", tk, p.peek().Type())
+		return p.errorf("expected %v, got %v", tk, p.peek().Type())
 	}
 
 	return nil
 }
 
+// expectName consumes the identifier naming a variable, function or argument.
+// Using a reserved keyword as a name gets an error of its own.
+func (p *Parser) expectName() (token.Identifier, error) {
+	switch tk := p.next().(type) {
+	case token.Identifier:
+		return tk, nil
+	default:
+		if name, ok := token.KeywordName(tk); ok {
+			return token.Identifier{}, p.errorf("%s is a reserved keyword and cannot be used as a name", name)
+		}
+		return token.Identifier{}, p.errorf("expected %v, got %v", token.IdentifierType, tk.Type())
+	}
+}
+
 // peek will return the current token without consuming it
 func (p *Parser) peek() token.Token {
-	if p.current >= len(p.tokens) {
-		return token.EOF{}
+	tk, ok := p.at(p.current)
+	if !ok {
+		return p.eof()
 	}
 
-	return p.tokens[p.current]
+	return tk
 }
 
 func (p *Parser) peekNext() token.Token {
-	if p.current+1 >= len(p.tokens) {
-		return token.EOF{}
+	tk, ok := p.at(p.current + 1)
+	if !ok {
+		return p.eof()
 	}
 
-	return p.tokens[p.current+1]
+	return tk
 }
 
 // putBack will move the current token back one step
@@ -73,101 +222,161 @@ type Program struct {
 	Body []Statement
 }
 
+// ParseFile parses a complete source file.
+// Parsing continues after errors, and all problems found are returned together as diag.Diagnostics.
+// The program is returned even then, without the statements that failed to parse, so that it can still be type checked.
 func (p *Parser) ParseFile() (Program, error) {
 	globalScope := NewScope(p.scope)
 
+	// The variables whose values have not been parsed yet
+	uninitialized := make(map[string]VarDecl)
+
 	for tk := p.peek(); tk.Type() != token.EOFType; tk = p.next() {
 		var stmt Statement
 		switch tk.(type) {
-		case token.VarDecl:
-			fmt.Println("Parsing variable declaration")
-			varDecl, err := p.parseVarDecl()
-			if err != nil {
-				return Program{}, err
+		case token.VarDecl, token.Type, token.Const, token.OpenBracket:
+			varDecl, ok := p.declareGlobalVar(uninitialized)
+			if !ok {
+				continue
 			}
 			stmt = varDecl
 
-			err = globalScope.RegisterVar(varDecl)
-			if err != nil {
-				return Program{}, err
+		case token.FnDef:
+			// A variable declared with a function type, like fn(int) int f = g;
+			if _, ok := p.peekNext().(token.OpenParen); ok {
+				varDecl, ok := p.declareGlobalVar(uninitialized)
+				if !ok {
+					continue
+				}
+				stmt = varDecl
+				break
 			}
 
-		case token.FnDef:
-			fmt.Println("Parsing function definition")
 			fnDef, err := p.parseFnDef()
 			if err != nil {
-				return Program{}, err
+				p.report(err)
+				p.synchronize(false)
+				continue
 			}
 			stmt = fnDef
 
-			err = globalScope.RegisterFn(fnDef)
-			if err != nil {
-				return Program{}, err
+			// Functions can neither be redeclared in the file nor shadow the predeclared ones in the parent scope
+			if prev, ok := globalScope.ResolveFn(fnDef.Name); ok {
+				d := diag.Errorf(diag.CodeRedeclared, fnDef.Span(), "function %s already declared", fnDef.Name)
+				if prev.Span().Start.IsValid() {
+					d = d.WithNote(prev.Span(), "previous declaration of %s", prev.Name)
+				}
+				p.diags.Add(d)
+			} else {
+				globalScope.RegisterFn(fnDef)
 			}
 
 		default:
-			return Program{}, fmt.Errorf("unexpected token type %T", tk)
+			p.report(p.errorf("unexpected %v", tk.Type()))
+			p.synchronize(false)
+			continue
 		}
 
 		p.Program.Body = append(p.Program.Body, stmt)
 	}
 
-	// Parse all the function bodies in the file now that the global scope has been built.
-	for i, fnDef := range p.Program.Body {
-		if fnDef, ok := fnDef.(FnDef); ok {
-			parsedFnDef, err := fnDef.parseBody(globalScope)
+	// Parse the values of the variables now that all functions are known.
+	// They are initialized in source order, so each value can only use the variables declared before it.
+	// Variables whose value fails to parse are left out of the program.
+	body := p.Program.Body[:0]
+	for _, stmt := range p.Program.Body {
+		if varDecl, ok := stmt.(VarDecl); ok {
+			parsedVarDecl, err := varDecl.parseValue(globalScope, uninitialized)
+			delete(uninitialized, varDecl.Name)
 			if err != nil {
-				return Program{}, fmt.Errorf("failed to parse function body for %s: %w", fnDef.Name, err)
+				p.report(err)
+				continue
 			}
-			p.Program.Body[i] = parsedFnDef
+			globalScope.RegisterVar(parsedVarDecl)
+			stmt = parsedVarDecl
 		}
+		body = append(body, stmt)
 	}
+	p.Program.Body = body
 
-	if !slices.ContainsFunc(p.Program.Body, func(stmt Statement) bool {
-		if fnDef, ok := stmt.(FnDef); ok {
-			return fnDef.Name == "main"
+	// Parse all the function bodies in the file now that the global scope has been built.
+	for i, fnDef := range p.Program.Body {
+		if fnDef, ok := fnDef.(FnDef); ok {
+			parsedFnDef, diags := fnDef.parseBody(globalScope)
+			p.diags.Add(diags...)
+			p.Program.Body[i] = parsedFnDef
 		}
-		return false
-	}) {
-		return Program{}, fmt.Errorf("no main function found in file")
 	}
 
-	return p.Program, nil
+	p.checkInitOrder()
+
+	p.diags.Sort()
+	return p.Program, p.diags.Err()
 }
 
-func (p *Parser) parseBlock() ([]Statement, error) {
+// parseBlock parses statements up to the closing brace of the block.
+// A statement that fails to parse is reported and skipped.
+func (p *Parser) parseBlock() []Statement {
 	stmts := []Statement{}
 
 	for tk := p.peek(); tk.Type() != token.CloseBraceType; tk = p.next() {
+		if tk.Type() == token.EOFType {
+			p.report(p.errorf("unexpected EOF, expected end of block"))
+			break
+		}
+
 		stmt, err := p.ParseStatement()
 		if err != nil {
-			return nil, err
+			p.report(err)
+			p.synchronize(true)
+			continue
 		}
 
-		if err := p.expect(token.SemicolonType); err != nil {
-			return nil, err
+		// Statements that end with a block are not terminated by a semicolon
+		if !endsWithBlock(stmt) {
+			if err := p.expect(token.SemicolonType); err != nil {
+				p.report(err)
+				p.synchronize(true)
+				continue
+			}
 		}
 
 		stmts = append(stmts, stmt)
 	}
 
-	return stmts, nil
+	return stmts
+}
+
+func endsWithBlock(stmt Statement) bool {
+	switch stmt.(type) {
+	case If, While, For, ForEach, Block:
+		return true
+	}
+
+	return false
 }
 
-func (fn FnDef) parseBody(s *Scope) (FnDef, error) {
-	fmt.Println("Scope: ", s.varDecls)
+// parseBody parses the statements of the function body in a new scope under s.
+// The function is returned together with all problems found in the body, including warnings.
+func (fn FnDef) parseBody(s *Scope) (FnDef, diag.Diagnostics) {
 	p := Parser{
-		tokens: fn.bodySrc,
-		scope:  NewScope(s),
+		tokens:     fn.bodySrc,
+		scope:      NewScope(s),
+		globals:    s,
+		uses:       &uses{},
+		returnType: fn.ReturnType,
 	}
 
-	stmts, err := p.parseBlock()
-	if err != nil {
-		return FnDef{}, fmt.Errorf("failed to parse function body: %w", err)
+	for _, arg := range fn.Args {
+		if err := p.scope.RegisterVar(VarDecl{Name: arg.Name, Type: arg.Type}); err != nil {
+			p.diags.Add(diag.Errorf(diag.CodeRedeclared, fn.Span(), "%v", err))
+		}
 	}
 
-	fn.Body = stmts
+	fn.Body = p.parseBlock()
 	fn.bodySrc = nil
+	fn.uses = p.uses
+	fn.incomplete = p.diags.HasErrors()
 
-	return fn, nil
+	return fn, p.diags
 }
@@ -1,9 +1,11 @@
 package parser
 
 import (
+	"fmt"
+	"leoscript/diag"
 	"leoscript/lexer"
-	"leoscript/token"
 	"leoscript/types"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -279,109 +281,112 @@ func Test_Expr_Parse(t *testing.T) {
 	})
 }
 
-func Test_Expr_PriorityMerge(t *testing.T) {
-	t.Run("Merge with same priority", func(t *testing.T) {
-		left := BinaryExpression{
-			Left:     IntegerLiteral{Value: 1},
-			Right:    IntegerLiteral{Value: 2},
-			Op:       "+",
-			priority: token.PRIO_SUM,
-		}
-
-		right := IntegerLiteral{Value: 3}
-
-		newExpr := left.PriorityMerge(token.Operator{Op: "+"}, right)
+func Test_Expr_Precedence(t *testing.T) {
+	t.Run("Unary binds tighter than binary operators", func(t *testing.T) {
+		lx := lexer.MustTokenize("-1 * 2;")
+		p := Parser{tokens: lx}
+		prog, err := p.ParseExpr()
+		assert.NoError(t, err)
 
 		assert.EqualExportedValues(t, BinaryExpression{
-			Left:  left,
-			Right: right,
-			Op:    "+",
-		}, newExpr)
+			Left: UnaryExpression{
+				Expression: IntegerLiteral{Value: 1},
+				Op:         "-",
+			},
+			Right: IntegerLiteral{Value: 2},
+			Op:    "*",
+		}, prog)
 	})
 
-	t.Run("Merge with lower priority", func(t *testing.T) {
-		left := BinaryExpression{
-			Left:     IntegerLiteral{Value: 1},
-			Right:    IntegerLiteral{Value: 2},
-			Op:       "*",
-			priority: token.PRIO_SUM,
-		}
-
-		right := IntegerLiteral{Value: 3}
-
-		newExpr := left.PriorityMerge(token.Operator{Op: "-"}, right)
+	t.Run("Negation before comparison", func(t *testing.T) {
+		lx := lexer.MustTokenize("!true == false;")
+		p := Parser{tokens: lx}
+		prog, err := p.ParseExpr()
+		assert.NoError(t, err)
 
 		assert.EqualExportedValues(t, BinaryExpression{
-			Left:     left,
-			Right:    right,
-			Op:       "-",
-			priority: token.PRIO_SUM,
-		}, newExpr)
-	})
-
-	t.Run("Merge with higher priority", func(t *testing.T) {
-		left := BinaryExpression{
-			Left:     IntegerLiteral{Value: 1},
-			Right:    IntegerLiteral{Value: 2},
-			Op:       "+",
-			priority: token.PRIO_SUM,
-		}
-
-		right := IntegerLiteral{Value: 3}
+			Left: UnaryExpression{
+				Expression: BooleanLiteral{Value: true},
+				Op:         "!",
+			},
+			Right: BooleanLiteral{Value: false},
+			Op:    "==",
+		}, prog)
+	})
 
-		newExpr := left.PriorityMerge(token.Operator{Op: "*"}, right)
+	t.Run("Every priority level", func(t *testing.T) {
+		lx := lexer.MustTokenize("1 + 2 * 3 < 4 == true && false || true;")
+		p := Parser{tokens: lx}
+		prog, err := p.ParseExpr()
+		assert.NoError(t, err)
 
 		assert.EqualExportedValues(t, BinaryExpression{
-			Left: IntegerLiteral{Value: 1},
-			Right: BinaryExpression{
-				Left:  IntegerLiteral{Value: 2},
-				Right: right,
-				Op:    "*",
+			Left: BinaryExpression{
+				Left: BinaryExpression{
+					Left: BinaryExpression{
+						Left: BinaryExpression{
+							Left: IntegerLiteral{Value: 1},
+							Right: BinaryExpression{
+								Left:  IntegerLiteral{Value: 2},
+								Right: IntegerLiteral{Value: 3},
+								Op:    "*",
+							},
+							Op: "+",
+						},
+						Right: IntegerLiteral{Value: 4},
+						Op:    "<",
+					},
+					Right: BooleanLiteral{Value: true},
+					Op:    "==",
+				},
+				Right: BooleanLiteral{Value: false},
+				Op:    "&&",
 			},
-			Op: "+",
-		}, newExpr)
+			Right: BooleanLiteral{Value: true},
+			Op:    "||",
+		}, prog)
 	})
 
-	t.Run("Merge with higher priority, multiple layers", func(t *testing.T) {
-		left := BinaryExpression{
-			Left: IntegerLiteral{Value: 1},
-			Right: BinaryExpression{
-				Left: BooleanLiteral{Value: false},
-				Right: BinaryExpression{
-					Left:     BooleanLiteral{Value: true},
-					Right:    BooleanLiteral{Value: true},
-					Op:       "||",
-					priority: token.PRIO_OR,
+	t.Run("Left associative chain after a higher priority", func(t *testing.T) {
+		lx := lexer.MustTokenize("1 * 2 - 3 - 4;")
+		p := Parser{tokens: lx}
+		prog, err := p.ParseExpr()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, BinaryExpression{
+			Left: BinaryExpression{
+				Left: BinaryExpression{
+					Left:  IntegerLiteral{Value: 1},
+					Right: IntegerLiteral{Value: 2},
+					Op:    "*",
 				},
-				Op:       "&&",
-				priority: token.PRIO_AND,
+				Right: IntegerLiteral{Value: 3},
+				Op:    "-",
 			},
-			Op: "+",
-		}
+			Right: IntegerLiteral{Value: 4},
+			Op:    "-",
+		}, prog)
+	})
 
-		right := IntegerLiteral{Value: 10}
+	t.Run("Operand missing after operator", func(t *testing.T) {
+		lx := lexer.MustTokenize("1 + ;")
+		p := Parser{tokens: lx}
+		_, err := p.ParseExpr()
+		assert.ErrorContains(t, err, "1:5: unexpected token in primary expression: ;")
+	})
 
-		newExpr := left.PriorityMerge(token.Operator{Op: "*"}, right)
+	t.Run("Expressions next to each other", func(t *testing.T) {
+		lx := lexer.MustTokenize("(1 + 2) (3);")
+		p := Parser{tokens: lx}
+		_, err := p.ParseExpr()
+		assert.EqualError(t, err, "1:9: unexpected token in expression: (")
+	})
 
-		assert.EqualExportedValues(t, BinaryExpression{
-			Left: IntegerLiteral{Value: 1},
-			Right: BinaryExpression{
-				Left: BooleanLiteral{Value: false},
-				Right: BinaryExpression{
-					Left: BooleanLiteral{Value: true},
-					Right: BinaryExpression{
-						Left:  BooleanLiteral{Value: true},
-						Right: IntegerLiteral{Value: 10},
-						Op:    "*",
-					},
-					Op:       "||",
-					priority: token.PRIO_OR,
-				},
-				Op:       "&&",
-				priority: token.PRIO_AND,
-			},
-			Op: "+",
-		}, newExpr)
+	t.Run("Operator that cannot be binary", func(t *testing.T) {
+		lx := lexer.MustTokenize("1 ! 2;")
+		p := Parser{tokens: lx}
+		_, err := p.ParseExpr()
+		assert.ErrorContains(t, err, "1:3: unexpected token in expression")
 	})
 }
 
@@ -464,6 +469,52 @@ func Test_Expr_Boolean(t *testing.T) {
 	})
 }
 
+func Test_Expr_Strings(t *testing.T) {
+	t.Run("Concatenation", func(t *testing.T) {
+		lx := lexer.MustTokenize(`"a" + "b" == "ab";`)
+		p := Parser{tokens: lx}
+		prog, err := p.ParseExpr()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, BinaryExpression{
+			Left: BinaryExpression{
+				Left:  StringLiteral{Value: "a"},
+				Right: StringLiteral{Value: "b"},
+				Op:    "+",
+			},
+			Right: StringLiteral{Value: "ab"},
+			Op:    "==",
+		}, prog)
+	})
+
+	t.Run("String variable", func(t *testing.T) {
+		p := Parser{tokens: lexer.MustTokenize(`fn f() string { string s = "x"; return s + "y"; }`)}
+		prog, err := p.ParseFile()
+		assert.NoError(t, err)
+		assert.Equal(t, types.String, prog.Body[0].(FnDef).ReturnType)
+	})
+}
+
+func Test_Expr_Floats(t *testing.T) {
+	t.Run("Mixed arithmetic", func(t *testing.T) {
+		lx := lexer.MustTokenize("1 + 2.5 * 2;")
+		p := Parser{tokens: lx}
+		prog, err := p.ParseExpr()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, BinaryExpression{
+			Left: IntegerLiteral{Value: 1},
+			Right: BinaryExpression{
+				Left:  FloatLiteral{Value: 2.5},
+				Right: IntegerLiteral{Value: 2},
+				Op:    "*",
+			},
+			Op: "+",
+		}, prog)
+		assert.Equal(t, types.Float, prog.ReturnType())
+	})
+}
+
 func Test_Expr_Comparisons(t *testing.T) {
 	t.Run("simple equality", func(t *testing.T) {
 		lx := lexer.MustTokenize("1 == 2;")
@@ -704,6 +755,71 @@ func Test_Stmnt_VarDecl(t *testing.T) {
 	})
 }
 
+func Test_Stmnt_Const(t *testing.T) {
+	t.Run("Constant expressions are evaluated", func(t *testing.T) {
+		lx := lexer.MustTokenize(`const size = 2 * (3 + 4);
+const float half = size / 4 + 0.5;
+const ok = !(size > 10) || "a" + "b" == "ab";`)
+		prog, err := NewParser(lx, nil).ParseFile()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, Program{
+			Body: []Statement{
+				VarDecl{Name: "size", Type: types.Int, Value: IntegerLiteral{Value: 14}, Const: true},
+				VarDecl{Name: "half", Type: types.Float, Value: FloatLiteral{Value: 3.5}, Const: true},
+				VarDecl{Name: "ok", Type: types.Bool, Value: BooleanLiteral{Value: true}, Const: true},
+			},
+		}, prog)
+		assert.Equal(t, "2:20", prog.Body[1].(VarDecl).Value.Span().Start.String())
+	})
+
+	t.Run("Values that are not constant", func(t *testing.T) {
+		scope := NewScope(nil)
+		scope.RegisterVar(VarDecl{Name: "v", Type: types.Int})
+		scope.RegisterFn(FnDef{Name: "f", ReturnType: types.Int})
+
+		for src, msg := range map[string]string{
+			"const a = 1 + v;":     "1:15: v is not a constant",
+			"const a = f() * 2;":   "1:11: call of f is not a constant expression",
+			"const a = 1 / (2-2);": "1:11: division by zero",
+			"const a = 1 + true;":  "1:11: operator + cannot be used with int and bool",
+		} {
+			p := Parser{tokens: lexer.MustTokenize(src), scope: scope}
+			_, err := p.ParseStatement()
+			assert.EqualError(t, err, msg, src)
+		}
+	})
+
+	t.Run("Constants cannot be assigned to", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+			const limit = 10;
+
+			fn f() {
+				limit += 1;
+			}
+		`)
+		_, err := NewParser(lx, nil).ParseFile()
+		assert.EqualError(t, err, "5:5: cannot assign to constant limit\n\t2:4: note: limit is declared here")
+
+		var diags diag.Diagnostics
+		assert.ErrorAs(t, err, &diags)
+		assert.Equal(t, diag.CodeConstAssign, diags[0].Code)
+	})
+
+	t.Run("Functions cannot be assigned to", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+			fn f() {}
+			fn g() {}
+
+			fn main() {
+				f = g;
+			}
+		`)
+		_, err := NewParser(lx, nil).ParseFile()
+		assert.EqualError(t, err, "6:5: cannot assign to function f\n\t2:4: note: f is declared here")
+	})
+}
+
 func Test_ReturnTypes(t *testing.T) {
 	t.Run("Literals", func(t *testing.T) {
 		assert.Equal(t, types.Int, IntegerLiteral{Value: 123}.ReturnType())
@@ -749,6 +865,43 @@ func Test_ReturnTypes(t *testing.T) {
 			Op:    "==",
 		}.ReturnType())
 	})
+	t.Run("Float promotion", func(t *testing.T) {
+		assert.Equal(t, types.Float, FloatLiteral{Value: 1.5}.ReturnType())
+
+		assert.Equal(t, types.Float, BinaryExpression{
+			Left:  IntegerLiteral{Value: 1},
+			Right: FloatLiteral{Value: 0.5},
+			Op:    "*",
+		}.ReturnType())
+
+		assert.Equal(t, types.Float, BinaryExpression{
+			Left:  FloatLiteral{Value: 0.5},
+			Right: IntegerLiteral{Value: 1},
+			Op:    "-",
+		}.ReturnType())
+
+		assert.Equal(t, types.Bool, BinaryExpression{
+			Left:  FloatLiteral{Value: 0.5},
+			Right: IntegerLiteral{Value: 1},
+			Op:    "<",
+		}.ReturnType())
+	})
+
+	t.Run("String expressions", func(t *testing.T) {
+		assert.Equal(t, types.String, StringLiteral{Value: "a"}.ReturnType())
+
+		assert.Equal(t, types.String, BinaryExpression{
+			Left:  StringLiteral{Value: "a"},
+			Right: StringLiteral{Value: "b"},
+			Op:    "+",
+		}.ReturnType())
+
+		assert.Equal(t, types.Bool, BinaryExpression{
+			Left:  StringLiteral{Value: "a"},
+			Right: StringLiteral{Value: "b"},
+			Op:    "<",
+		}.ReturnType())
+	})
 }
 
 func Test_Identifiers(t *testing.T) {
@@ -773,8 +926,8 @@ func Test_FunctionDefinitions(t *testing.T) {
 		fnDef, err := p.parseFnDef()
 		assert.NoError(t, err)
 
-		fn, err := fnDef.parseBody(new(Scope))
-		assert.NoError(t, err)
+		fn, diags := fnDef.parseBody(new(Scope))
+		assert.Empty(t, diags)
 
 		assert.EqualExportedValues(t, FnDef{
 			Name:       "foo",
@@ -790,8 +943,8 @@ func Test_FunctionDefinitions(t *testing.T) {
 		fnDef, err := p.parseFnDef()
 		assert.NoError(t, err)
 
-		fn, err := fnDef.parseBody(new(Scope))
-		assert.NoError(t, err)
+		fn, diags := fnDef.parseBody(new(Scope))
+		assert.Empty(t, diags)
 
 		assert.EqualExportedValues(t, FnDef{
 			Name:       "foo",
@@ -815,8 +968,8 @@ func Test_FunctionDefinitions(t *testing.T) {
 		fnDef, err := p.parseFnDef()
 		assert.NoError(t, err)
 
-		fn, err := fnDef.parseBody(new(Scope))
-		assert.NoError(t, err)
+		fn, diags := fnDef.parseBody(new(Scope))
+		assert.Empty(t, diags)
 
 		assert.EqualExportedValues(t, FnDef{
 			Name:       "foo",
@@ -832,8 +985,8 @@ func Test_FunctionDefinitions(t *testing.T) {
 		fnDef, err := p.parseFnDef()
 		assert.NoError(t, err)
 
-		fn, err := fnDef.parseBody(new(Scope))
-		assert.NoError(t, err)
+		fn, diags := fnDef.parseBody(new(Scope))
+		assert.Empty(t, diags)
 
 		assert.EqualExportedValues(t, FnDef{
 			Name:       "foo",
@@ -851,8 +1004,8 @@ func Test_FunctionDefinitions(t *testing.T) {
 		fnDef, err := p.parseFnDef()
 		assert.NoError(t, err)
 
-		fn, err := fnDef.parseBody(new(Scope))
-		assert.NoError(t, err)
+		fn, diags := fnDef.parseBody(new(Scope))
+		assert.Empty(t, diags)
 
 		assert.EqualExportedValues(t, FnDef{
 			Name:       "foo",
@@ -872,8 +1025,8 @@ func Test_FunctionDefinitions(t *testing.T) {
 		fnDef, err := p.parseFnDef()
 		assert.NoError(t, err)
 
-		fn, err := fnDef.parseBody(new(Scope))
-		assert.NoError(t, err)
+		fn, diags := fnDef.parseBody(new(Scope))
+		assert.Empty(t, diags)
 
 		assert.EqualExportedValues(t, FnDef{
 			Name:       "foo",
@@ -898,8 +1051,8 @@ func Test_FunctionDefinitions(t *testing.T) {
 		fnDef, err := p.parseFnDef()
 		assert.NoError(t, err)
 
-		fn, err := fnDef.parseBody(NewScope(nil))
-		assert.NoError(t, err)
+		fn, diags := fnDef.parseBody(NewScope(nil))
+		assert.Empty(t, diags)
 
 		assert.EqualExportedValues(t, FnDef{
 			Name:       "foo",
@@ -968,6 +1121,48 @@ func Test_FunctionDefinitions(t *testing.T) {
 }
 
 func Test_ParseFile(t *testing.T) {
+	t.Run("Streamed from a lexer", func(t *testing.T) {
+		sb := strings.Builder{}
+		for i := range 200 {
+			fmt.Fprintf(&sb, "fn f%d(int a) int {\n\tvar b = a * 2;\n\treturn b + %d;\n}\n", i, i)
+		}
+
+		p := NewStreamParser(lexer.New(strings.NewReader(sb.String())), nil)
+		prog, err := p.ParseFile()
+		assert.NoError(t, err)
+		assert.Len(t, prog.Body, 200)
+		assert.Equal(t, "f199", prog.Body[199].(FnDef).Name)
+
+		// Only a small window of tokens is kept
+		assert.Less(t, len(p.tokens), 100)
+	})
+
+	t.Run("Streamed errors match", func(t *testing.T) {
+		src := "fn main() int {\n\treturn 1 +"
+
+		_, err := NewStreamParser(lexer.New(strings.NewReader(src)), nil).ParseFile()
+		_, expected := NewParser(lexer.MustTokenize(src), nil).ParseFile()
+		assert.Error(t, err)
+		assert.Equal(t, expected, err)
+	})
+
+	t.Run("Doc comments", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+			var x = 1; // a global
+
+			// main is the entry point.
+			fn main() int {
+				// the answer
+				return x;
+			}
+		`)
+
+		p := Parser{tokens: lx}
+		prog, err := p.ParseFile()
+		assert.NoError(t, err)
+		assert.Equal(t, "main is the entry point.", prog.Body[1].(FnDef).Doc)
+	})
+
 	t.Run("Simple file", func(t *testing.T) {
 		lx := lexer.MustTokenize(`
 			fn foo() int {
@@ -1039,7 +1234,729 @@ func Test_ParseFile(t *testing.T) {
 		`)
 		p := Parser{tokens: lx}
 		prog, err := p.ParseFile()
-		assert.ErrorContains(t, err, "no main function")
-		assert.Empty(t, prog)
+		assert.NoError(t, err, "main is optional for library scripts")
+		assert.Len(t, prog.Body, 1)
+	})
+
+	t.Run("Global variables", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+			var a = 1;
+			float b = a + half();
+
+			fn half() float {
+				return 0.5;
+			}
+		`)
+		p := Parser{tokens: lx}
+		prog, err := p.ParseFile()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, VarDecl{
+			Name: "b",
+			Type: types.Float,
+			Value: BinaryExpression{
+				Left:  Identifier{Name: "a"},
+				Right: Call{Name: "half", Args: []Expression{}},
+				Op:    "+",
+			},
+		}, prog.Body[1])
+	})
+
+	t.Run("Globals used before they are initialized", func(t *testing.T) {
+		lx := lexer.MustTokenize(`var a = b + 1;
+var b = 2;
+var c = c;
+var d = get();
+var e = 5;
+fn get() int { return twice(); }
+fn twice() int { return e * 2; }
+var f = self();
+fn self() int { return f; }`)
+		_, err := NewParser(lx, nil).ParseFile()
+		assert.EqualError(t, err, `1:9: b is used before it is initialized
+	2:1: note: b is declared here
+3:9: initialization of c refers to itself
+4:9: get uses e before it is initialized
+	7:25: note: e is used by twice here
+8:9: initialization of f refers to itself through self
+	9:24: note: f is used by self here`)
+
+		var diags diag.Diagnostics
+		assert.ErrorAs(t, err, &diags)
+		assert.Equal(t, []diag.Code{diag.CodeInitOrder, diag.CodeInitCycle, diag.CodeInitOrder, diag.CodeInitCycle},
+			[]diag.Code{diags[0].Code, diags[1].Code, diags[2].Code, diags[3].Code})
+	})
+
+	t.Run("Functions can use globals declared after them", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+			fn get() int { return x; }
+			var x = 1;
+			var y = get();
+		`)
+		_, err := NewParser(lx, nil).ParseFile()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Redeclared global", func(t *testing.T) {
+		lx := lexer.MustTokenize("var a = 1;\nint a = 2;")
+		_, err := NewParser(lx, nil).ParseFile()
+		assert.EqualError(t, err, "2:1: variable a already declared\n\t1:1: note: previous declaration of a")
+	})
+}
+
+func Test_Spans(t *testing.T) {
+	t.Run("Expression spans", func(t *testing.T) {
+		lx := lexer.MustTokenize("1 + (20 * -x);")
+		p := Parser{tokens: lx, scope: &Scope{varDecls: map[string]VarDecl{"x": {Name: "x", Type: types.Int}}}}
+		expr, err := p.ParseExpr()
+		assert.NoError(t, err)
+
+		assert.Equal(t, 0, expr.Span().Start.Offset)
+		assert.Equal(t, 12, expr.Span().End.Offset)
+
+		right := expr.(BinaryExpression).Right
+		assert.Equal(t, "1:6", right.Span().Start.String())
+	})
+
+	t.Run("Statement spans", func(t *testing.T) {
+		lx := lexer.MustTokenize("fn main() int {\n  return 1;\n}")
+		p := NewParser(lx, nil)
+		prog, err := p.ParseFile()
+		assert.NoError(t, err)
+
+		fn := prog.Body[0].(FnDef)
+		assert.Equal(t, "1:1", fn.Span().Start.String())
+		assert.Equal(t, "3:2", fn.Span().End.String())
+		assert.Equal(t, "2:3", fn.Body[0].Span().Start.String())
+	})
+}
+
+func Test_Diagnostics(t *testing.T) {
+	t.Run("Keywords used as names", func(t *testing.T) {
+		lx := lexer.MustTokenize(`fn while() {}`)
+		p := Parser{tokens: lx}
+		_, err := p.ParseFile()
+		assert.EqualError(t, err, "1:4: while is a reserved keyword and cannot be used as a name")
+
+		lx = lexer.MustTokenize(`fn f(int string) {}`)
+		p = Parser{tokens: lx}
+		_, err = p.ParseFile()
+		assert.EqualError(t, err, "1:10: string is a reserved keyword and cannot be used as a name")
+
+		lx = lexer.MustTokenize(`fn f() {
+	var if = 1;
+	bool true = false;
+}`)
+		p = Parser{tokens: lx}
+		_, err = p.ParseFile()
+		assert.EqualError(t, err, "2:6: if is a reserved keyword and cannot be used as a name\n3:7: true is a reserved keyword and cannot be used as a name")
+	})
+
+	t.Run("Errors in several statements are all reported", func(t *testing.T) {
+		lx := lexer.MustTokenize(`fn main() int {
+	int a = true;
+	var b = c + 1;
+	var d = 2;
+	return d +;
+}
+
+var e = ;
+
+fn foo( {}
+`)
+		prog, err := NewParser(lx, nil).ParseFile()
+
+		var diags diag.Diagnostics
+		assert.ErrorAs(t, err, &diags)
+
+		var codes []diag.Code
+		var lines []int
+		for _, d := range diags {
+			codes = append(codes, d.Code)
+			lines = append(lines, d.Span.Start.Line)
+		}
+
+		// The type mismatch on line 2 is left for the type checker
+		assert.Equal(t, []diag.Code{diag.CodeUndeclared, diag.CodeSyntax, diag.CodeSyntax, diag.CodeSyntax}, codes)
+		assert.Equal(t, []int{3, 5, 8, 10}, lines)
+
+		// The statements that parsed are returned with the errors for the type checker
+		assert.Len(t, prog.Body, 1)
+		assert.EqualExportedValues(t, Program{Body: []Statement{
+			VarDecl{Name: "a", Type: types.Int, Value: BooleanLiteral{Value: true}},
+			VarDecl{Name: "d", Type: types.Int, Value: IntegerLiteral{Value: 2}},
+		}}, Program{Body: prog.Body[0].(FnDef).Body})
+	})
+
+	t.Run("Stray keywords", func(t *testing.T) {
+		lx := lexer.MustTokenize("fn main() {\n\telse;\n\tfn;\n}")
+		_, err := NewParser(lx, nil).ParseFile()
+		assert.EqualError(t, err, "2:2: unexpected else\n3:2: unexpected fn")
+	})
+
+	t.Run("Missing tokens are named by their syntax", func(t *testing.T) {
+		lx := lexer.MustTokenize("fn 1() {}")
+		_, err := NewParser(lx, nil).ParseFile()
+		assert.EqualError(t, err, "1:4: expected identifier, got integer literal")
+	})
+
+	t.Run("Redeclaration points at the previous declaration", func(t *testing.T) {
+		lx := lexer.MustTokenize("fn main() {}\nfn main() {}")
+		_, err := NewParser(lx, nil).ParseFile()
+
+		var diags diag.Diagnostics
+		assert.ErrorAs(t, err, &diags)
+		assert.Len(t, diags, 1)
+		assert.Equal(t, diag.CodeRedeclared, diags[0].Code)
+		assert.EqualError(t, err, "2:1: function main already declared\n\t1:1: note: previous declaration of main")
+	})
+
+	t.Run("Valid statements in a block are kept", func(t *testing.T) {
+		lx := lexer.MustTokenize("fn foo() { var a = ; return 1; }")
+		p := NewParser(lx, nil)
+		fnDef, err := p.parseFnDef()
+		assert.NoError(t, err)
+
+		fn, diags := fnDef.parseBody(NewScope(nil))
+		assert.ErrorContains(t, diags.Err(), "1:20: unexpected token in primary expression")
+		assert.EqualExportedValues(t, FnDef{
+			Name:       "foo",
+			ReturnType: types.Void,
+			Args:       []Argument{},
+			Body: []Statement{
+				Return{Value: IntegerLiteral{Value: 1}},
+			},
+		}, fn)
+	})
+}
+
+func Test_Stmnt_Assignment(t *testing.T) {
+	scope := NewScope(nil)
+	scope.RegisterVar(VarDecl{Name: "a", Type: types.Int})
+
+	t.Run("Assignment", func(t *testing.T) {
+		lx := lexer.MustTokenize("a = 1 + 2;")
+		p := Parser{tokens: lx, scope: scope}
+		stmt, err := p.ParseStatement()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, Assignment{
+			Name: "a",
+			Value: BinaryExpression{
+				Left:  IntegerLiteral{Value: 1},
+				Right: IntegerLiteral{Value: 2},
+				Op:    "+",
+			},
+		}, stmt)
+	})
+
+	t.Run("Compound assignment", func(t *testing.T) {
+		lx := lexer.MustTokenize("a *= 1 + 2;")
+		p := Parser{tokens: lx, scope: scope}
+		stmt, err := p.ParseStatement()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, Assignment{
+			Name: "a",
+			Value: BinaryExpression{
+				Left: Identifier{Name: "a"},
+				Right: BinaryExpression{
+					Left:  IntegerLiteral{Value: 1},
+					Right: IntegerLiteral{Value: 2},
+					Op:    "+",
+				},
+				Op: "*",
+			},
+		}, stmt)
+		assert.Equal(t, "1:1", stmt.Span().Start.String())
+		assert.Equal(t, "1:11", stmt.Span().End.String())
+	})
+
+	t.Run("Increment and decrement", func(t *testing.T) {
+		for op, binOp := range map[string]string{"++": "+", "--": "-"} {
+			lx := lexer.MustTokenize("a" + op + ";")
+			p := Parser{tokens: lx, scope: scope}
+			stmt, err := p.ParseStatement()
+			assert.NoError(t, err)
+
+			assert.EqualExportedValues(t, Assignment{
+				Name: "a",
+				Value: BinaryExpression{
+					Left:  Identifier{Name: "a"},
+					Right: IntegerLiteral{Value: 1},
+					Op:    binOp,
+				},
+			}, stmt)
+		}
+	})
+
+	t.Run("Undeclared variable", func(t *testing.T) {
+		lx := lexer.MustTokenize("b += 1;")
+		p := Parser{tokens: lx, scope: scope}
+		_, err := p.ParseStatement()
+		assert.EqualError(t, err, "1:1: undeclared variable: b")
+	})
+
+	t.Run("Assignments are not expressions", func(t *testing.T) {
+		lx := lexer.MustTokenize("1 + a = 2;")
+		p := Parser{tokens: lx, scope: scope}
+		_, err := p.ParseExpr()
+		assert.ErrorContains(t, err, "1:7: unexpected token in expression")
+	})
+}
+
+func Test_Stmnt_Block(t *testing.T) {
+	t.Run("Block statement", func(t *testing.T) {
+		lx := lexer.MustTokenize("{ var a = 1; { return a; } }")
+		p := Parser{tokens: lx, scope: NewScope(nil)}
+		stmt, err := p.ParseStatement()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, Block{
+			Body: []Statement{
+				VarDecl{Name: "a", Type: types.Int, Value: IntegerLiteral{Value: 1}},
+				Block{
+					Body: []Statement{
+						Return{Value: Identifier{Name: "a"}},
+					},
+				},
+			},
+		}, stmt)
+		assert.Equal(t, "1:1", stmt.Span().Start.String())
+		assert.Equal(t, "1:29", stmt.Span().End.String())
+	})
+
+	t.Run("Variables go out of scope at the end of the block", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+			fn main() int {
+				{
+					var a = 1;
+				}
+				var a = true;
+				{
+					var b = 2;
+				}
+				return b;
+			}
+		`)
+		_, err := NewParser(lx, nil).ParseFile()
+		assert.EqualError(t, err, "10:12: undeclared variable: b")
+	})
+
+	t.Run("Shadowing is warned about", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+			var g = 1;
+
+			fn main(int n) int {
+				var g = 2;
+				var a = 3;
+				{
+					var a = 4;
+					int n = 5;
+				}
+				return a;
+			}
+		`)
+		p := NewParser(lx, nil)
+		_, err := p.ParseFile()
+		assert.NoError(t, err)
+
+		diags := p.Diagnostics()
+		assert.Equal(t, "8:6: warning: declaration of a shadows a variable of an enclosing block\n\t6:5: note: shadowed declaration of a\n"+
+			"9:6: warning: declaration of n shadows a variable of an enclosing block", diags.Error())
+		assert.Equal(t, diag.CodeShadowed, diags[0].Code)
+	})
+}
+
+func Test_Stmnt_If(t *testing.T) {
+	t.Run("If without else", func(t *testing.T) {
+		lx := lexer.MustTokenize("if (1 < 2) { return 1; }")
+		p := Parser{tokens: lx, scope: NewScope(nil)}
+		stmt, err := p.ParseStatement()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, If{
+			Condition: BinaryExpression{
+				Left:  IntegerLiteral{Value: 1},
+				Right: IntegerLiteral{Value: 2},
+				Op:    "<",
+			},
+			Body: []Statement{
+				Return{Value: IntegerLiteral{Value: 1}},
+			},
+		}, stmt)
+	})
+
+	t.Run("If, else if and else", func(t *testing.T) {
+		lx := lexer.MustTokenize("if (true) { return 1; } else if (false) { return 2; } else { return 3; }")
+		p := Parser{tokens: lx, scope: NewScope(nil)}
+		stmt, err := p.ParseStatement()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, If{
+			Condition: BooleanLiteral{Value: true},
+			Body: []Statement{
+				Return{Value: IntegerLiteral{Value: 1}},
+			},
+			Else: []Statement{
+				If{
+					Condition: BooleanLiteral{Value: false},
+					Body: []Statement{
+						Return{Value: IntegerLiteral{Value: 2}},
+					},
+					Else: []Statement{
+						Return{Value: IntegerLiteral{Value: 3}},
+					},
+				},
+			},
+		}, stmt)
+	})
+
+	t.Run("Variables in a branch are scoped to it", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+			fn main() int {
+				if (true) {
+					var a = 1;
+				}
+				return a;
+			}
+		`)
+		_, err := NewParser(lx, nil).ParseFile()
+		assert.ErrorContains(t, err, "undeclared variable: a")
+	})
+}
+
+func Test_Stmnt_Loops(t *testing.T) {
+	t.Run("While loop", func(t *testing.T) {
+		lx := lexer.MustTokenize("while (a < 10) { a = a + 1; }")
+		p := Parser{tokens: lx, scope: &Scope{varDecls: map[string]VarDecl{"a": {Name: "a", Type: types.Int}}}}
+		stmt, err := p.ParseStatement()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, While{
+			Condition: BinaryExpression{
+				Left:  Identifier{Name: "a"},
+				Right: IntegerLiteral{Value: 10},
+				Op:    "<",
+			},
+			Body: []Statement{
+				Assignment{
+					Name: "a",
+					Value: BinaryExpression{
+						Left:  Identifier{Name: "a"},
+						Right: IntegerLiteral{Value: 1},
+						Op:    "+",
+					},
+				},
+			},
+		}, stmt)
+	})
+
+	t.Run("For loop", func(t *testing.T) {
+		lx := lexer.MustTokenize("for (var i = 0; i < 3; i = i + 1) { continue; }")
+		p := Parser{tokens: lx, scope: NewScope(nil)}
+		stmt, err := p.ParseStatement()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, For{
+			Init: VarDecl{Name: "i", Type: types.Int, Value: IntegerLiteral{Value: 0}},
+			Condition: BinaryExpression{
+				Left:  Identifier{Name: "i"},
+				Right: IntegerLiteral{Value: 3},
+				Op:    "<",
+			},
+			Post: Assignment{
+				Name: "i",
+				Value: BinaryExpression{
+					Left:  Identifier{Name: "i"},
+					Right: IntegerLiteral{Value: 1},
+					Op:    "+",
+				},
+			},
+			Body: []Statement{Continue{}},
+		}, stmt)
+
+		_, ok := p.scope.ResolveVar("i")
+		assert.False(t, ok, "loop variable should not leak out of the loop")
+	})
+
+	t.Run("For loop without clauses", func(t *testing.T) {
+		lx := lexer.MustTokenize("for (;;) { break; }")
+		p := Parser{tokens: lx, scope: NewScope(nil)}
+		stmt, err := p.ParseStatement()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, For{
+			Body: []Statement{Break{}},
+		}, stmt)
+	})
+
+	t.Run("Break outside of loop", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+			fn main() {
+				if (true) {
+					break;
+				}
+				continue;
+			}
+		`)
+		_, err := NewParser(lx, nil).ParseFile()
+
+		var diags diag.Diagnostics
+		assert.ErrorAs(t, err, &diags)
+		assert.Len(t, diags, 2)
+		assert.Equal(t, diag.CodeOutsideLoop, diags[0].Code)
+		assert.ErrorContains(t, err, "4:6: break is not in a loop")
+		assert.ErrorContains(t, err, "6:5: continue is not in a loop")
+	})
+}
+
+func Test_FunctionCalls(t *testing.T) {
+	scope := NewScope(nil)
+	scope.RegisterFn(FnDef{
+		Name:       "foo",
+		ReturnType: types.Bool,
+		Args:       []Argument{{Name: "a", Type: types.Int}, {Name: "b", Type: types.Bool}},
+	})
+
+	t.Run("Call with arguments", func(t *testing.T) {
+		lx := lexer.MustTokenize("foo(1 + 2, true);")
+		p := Parser{tokens: lx, scope: scope}
+		expr, err := p.ParseExpr()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, Call{
+			Name: "foo",
+			Args: []Expression{
+				BinaryExpression{
+					Left:  IntegerLiteral{Value: 1},
+					Right: IntegerLiteral{Value: 2},
+					Op:    "+",
+				},
+				BooleanLiteral{Value: true},
+			},
+		}, expr)
+		assert.Equal(t, types.Bool, expr.ReturnType())
+	})
+}
+
+func Test_FunctionValues(t *testing.T) {
+	t.Run("Function types", func(t *testing.T) {
+		lx := lexer.MustTokenize("fn(int, fn(string) bool) fn() float")
+		p := Parser{tokens: lx}
+		typ, err := p.parseType()
+		assert.NoError(t, err)
+
+		assert.Equal(t, types.Func([]types.Type{types.Int, types.Func([]types.Type{types.String}, types.Bool)}, types.Func(nil, types.Float)), typ)
+		assert.Equal(t, "fn(int, fn(string) bool) fn() float", fmt.Sprint(typ))
+	})
+
+	t.Run("Function literals", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+fn main() int {
+	var a = 1;
+	fn(int) int add = fn(int b) int { return a + b; };
+	return add(2);
+}`)
+		p := Parser{tokens: lx}
+		prog, err := p.ParseFile()
+		assert.NoError(t, err)
+
+		addType := types.Func([]types.Type{types.Int}, types.Int)
+		body := prog.Body[0].(FnDef).Body
+		assert.EqualExportedValues(t, Program{Body: []Statement{
+			VarDecl{
+				Name: "add",
+				Type: addType,
+				Value: FnLiteral{Fn: FnDef{
+					Name:       "anonymous function",
+					Args:       []Argument{{Name: "b", Type: types.Int}},
+					ReturnType: types.Int,
+					Body: []Statement{
+						Return{Value: BinaryExpression{
+							Left:  Identifier{Name: "a"},
+							Right: Identifier{Name: "b"},
+							Op:    "+",
+						}},
+					},
+				}},
+			},
+			Return{Value: Call{Name: "add", Args: []Expression{IntegerLiteral{Value: 2}}}},
+		}}, Program{Body: body[1:]})
+	})
+
+	t.Run("Calls of returned functions", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+fn adder(int a) fn(int) int {
+	return fn(int b) int { return a + b; };
+}
+
+fn main() int {
+	return adder(1)(2);
+}`)
+		p := Parser{tokens: lx}
+		prog, err := p.ParseFile()
+		assert.NoError(t, err)
+
+		ret := prog.Body[1].(FnDef).Body[0].(Return)
+		call := ret.Value.(Call)
+		assert.Empty(t, call.Name)
+		assert.Equal(t, "adder", call.Callee.(Call).Name)
+		assert.Equal(t, types.Int, call.ReturnType())
+	})
+
+	t.Run("Named functions as values", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+fn square(int n) int { return n * n; }
+
+var f = square;`)
+		p := Parser{tokens: lx}
+		prog, err := p.ParseFile()
+		assert.NoError(t, err)
+		assert.Equal(t, types.Func([]types.Type{types.Int}, types.Int), prog.Body[1].(VarDecl).Type)
+	})
+
+	t.Run("Calling a value that is not a function", func(t *testing.T) {
+		lx := lexer.MustTokenize(`fn main() {
+	var x = 1;
+	x(2);
+}`)
+		p := Parser{tokens: lx}
+		_, err := p.ParseFile()
+		assert.EqualError(t, err, "3:2: x is not a function, it is int")
+	})
+}
+
+func Test_Lists(t *testing.T) {
+	intList := types.List(types.Int)
+
+	t.Run("List types", func(t *testing.T) {
+		lx := lexer.MustTokenize("[][]fn([]int) bool")
+		p := Parser{tokens: lx}
+		typ, err := p.parseType()
+		assert.NoError(t, err)
+
+		assert.Equal(t, types.List(types.List(types.Func([]types.Type{intList}, types.Bool))), typ)
+		assert.Equal(t, "[][]fn([]int) bool", fmt.Sprint(typ))
+	})
+
+	t.Run("Literals, indexes and slices", func(t *testing.T) {
+		lx := lexer.MustTokenize(`
+fn main() {
+	var a = [1, 2 + 3];
+	[][]int b = [[], a[1:], a[:len(a)]];
+	a[0] = b[1][0];
+}`)
+		p := Parser{tokens: lx}
+		prog, err := p.ParseFile()
+		assert.NoError(t, err)
+
+		body := prog.Body[0].(FnDef).Body
+		assert.EqualExportedValues(t, Program{Body: []Statement{
+			VarDecl{
+				Name: "a",
+				Type: intList,
+				Value: ListLiteral{Elems: []Expression{
+					IntegerLiteral{Value: 1},
+					BinaryExpression{Left: IntegerLiteral{Value: 2}, Right: IntegerLiteral{Value: 3}, Op: "+"},
+				}},
+			},
+			VarDecl{
+				Name: "b",
+				Type: types.List(intList),
+				Value: ListLiteral{Elems: []Expression{
+					ListLiteral{Elems: []Expression{}},
+					SliceExpression{List: Identifier{Name: "a"}, Low: IntegerLiteral{Value: 1}},
+					SliceExpression{List: Identifier{Name: "a"}, High: BuiltinCall{Name: "len", Args: []Expression{Identifier{Name: "a"}}}},
+				}},
+			},
+			IndexAssignment{
+				Target: IndexExpression{List: Identifier{Name: "a"}, Index: IntegerLiteral{Value: 0}},
+				Value: IndexExpression{
+					List:  IndexExpression{List: Identifier{Name: "b"}, Index: IntegerLiteral{Value: 1}},
+					Index: IntegerLiteral{Value: 0},
+				},
+			},
+		}}, Program{Body: body})
+
+		// The empty list takes the element type of the list it is in
+		assert.Equal(t, intList, body[1].(VarDecl).Value.(ListLiteral).Elems[0].ReturnType())
+	})
+
+	t.Run("For-in loop", func(t *testing.T) {
+		lx := lexer.MustTokenize("for (var x in [1.5]) { x = x * 2; }")
+		p := Parser{tokens: lx, scope: NewScope(nil)}
+		stmt, err := p.ParseStatement()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, ForEach{
+			Var:  VarDecl{Name: "x", Type: types.Float},
+			List: ListLiteral{Elems: []Expression{FloatLiteral{Value: 1.5}}},
+			Body: []Statement{
+				Assignment{
+					Name:  "x",
+					Value: BinaryExpression{Left: Identifier{Name: "x"}, Right: IntegerLiteral{Value: 2}, Op: "*"},
+				},
+			},
+		}, stmt)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		lx := lexer.MustTokenize(`fn main() {
+	var n = 1;
+	var a = n[0];
+	var b = [];
+	[]int c = [1, 2];
+	c[0:1] = [3];
+	for (var x in n) {}
+	len(c);
+}`)
+		p := Parser{tokens: lx}
+		_, err := p.ParseFile()
+		assert.EqualError(t, err, "3:10: cannot index int\n"+
+			"4:10: cannot infer the type of b from its value, declare its type\n"+
+			"6:2: cannot assign to a slice, only to variables and list elements\n"+
+			"7:16: cannot loop over int\n"+
+			"8:2: the value of the expression is not used")
+	})
+}
+
+func Test_NumberConversions(t *testing.T) {
+	scope := NewScope(nil)
+	scope.RegisterVar(VarDecl{Name: "n", Type: types.Int})
+
+	t.Run("Ints are promoted to float", func(t *testing.T) {
+		lx := lexer.MustTokenize("[]float a = [1, n];")
+		p := Parser{tokens: lx, scope: scope}
+		stmt, err := p.ParseStatement()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, VarDecl{
+			Name: "a",
+			Type: types.List(types.Float),
+			Value: ListLiteral{Elems: []Expression{
+				FloatLiteral{Value: 1},
+				BuiltinCall{Name: "float", Args: []Expression{Identifier{Name: "n"}}},
+			}},
+		}, stmt)
+		assert.Equal(t, types.List(types.Float), stmt.(VarDecl).Value.ReturnType())
+	})
+
+	t.Run("Conversions", func(t *testing.T) {
+		lx := lexer.MustTokenize("int(2.5) + n;")
+		p := Parser{tokens: lx, scope: scope}
+		expr, err := p.ParseExpr()
+		assert.NoError(t, err)
+
+		assert.EqualExportedValues(t, BinaryExpression{
+			Left:  BuiltinCall{Name: "int", Args: []Expression{FloatLiteral{Value: 2.5}}},
+			Right: Identifier{Name: "n"},
+			Op:    "+",
+		}, expr)
+
+		lx = lexer.MustTokenize("string(n);")
+		p = Parser{tokens: lx, scope: scope}
+		_, err = p.ParseExpr()
+		assert.EqualError(t, err, "1:1: cannot convert to string, only to int and float")
 	})
 }
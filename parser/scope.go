@@ -35,12 +35,18 @@ func (s *Scope) RegisterFn(fnDef FnDef) error {
 }
 
 func (s *Scope) ResolveVar(name string) (VarDecl, bool) {
+	varDecl, _, ok := s.lookupVar(name)
+	return varDecl, ok
+}
+
+// lookupVar works like ResolveVar, but also returns the scope that declares the variable.
+func (s *Scope) lookupVar(name string) (VarDecl, *Scope, bool) {
 	varDecl, ok := s.varDecls[name]
 	if !ok && s.parent != nil {
-		return s.parent.ResolveVar(name)
+		return s.parent.lookupVar(name)
 	}
 
-	return varDecl, ok
+	return varDecl, s, ok
 }
 
 func (s *Scope) RegisterVar(varDecl VarDecl) error {
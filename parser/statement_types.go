@@ -5,27 +5,66 @@ import (
 	"leoscript/types"
 )
 
-type Statement interface{}
+type Statement interface {
+	// Span is the location in the source that the statement was parsed from.
+	Span() token.Span
+}
 
 type VarDecl struct {
 	Name  string
 	Type  types.Type
 	Value Expression
+	// Const is set for constants, which cannot be assigned to.
+	// The value of a constant is the literal it evaluates to.
+	Const bool
+	// The unprocessed source code of the value of a top-level variable, ending with the semicolon.
+	valueSrc []token.Token
+	// The globals used by the value of a top-level variable.
+	uses *uses
+	span token.Span
 }
 
+func (s VarDecl) Span() token.Span { return s.span }
+
 type FnDef struct {
 	Name       string
 	ReturnType types.Type
 	Args       []Argument
 	Body       []Statement
+	// Doc is the doc comment of the function, the comments directly preceding it.
+	Doc string
 	// The unprocessed source code of the function body.
 	bodySrc []token.Token
+	// The globals used by the function body.
+	uses *uses
+	// Whether statements of the body were left out because they failed to parse.
+	incomplete bool
+	span       token.Span
+}
+
+func (s FnDef) Span() token.Span { return s.span }
+
+// Incomplete reports whether statements of the body were left out because they failed to parse,
+// in which case the body cannot be checked for a missing return.
+func (s FnDef) Incomplete() bool { return s.incomplete }
+
+// Type returns the type of the function as a value.
+func (s FnDef) Type() types.Type {
+	params := make([]types.Type, 0, len(s.Args))
+	for _, arg := range s.Args {
+		params = append(params, arg.Type)
+	}
+
+	return types.Func(params, s.ReturnType)
 }
 
 type Return struct {
 	Value Expression
+	span  token.Span
 }
 
+func (s Return) Span() token.Span { return s.span }
+
 type Argument struct {
 	Name string
 	Type types.Type
@@ -34,4 +73,80 @@ type Argument struct {
 type Assignment struct {
 	Name  string
 	Value Expression
+	span  token.Span
+}
+
+func (s Assignment) Span() token.Span { return s.span }
+
+// IndexAssignment assigns to an element of a list, like a[i] = v.
+type IndexAssignment struct {
+	Target IndexExpression
+	// Op is the operation of a compound assignment, like + for a[i] += v, and empty for a plain assignment.
+	// The value of a[i]++ and a[i]-- is 1.
+	Op    string
+	Value Expression
+	span  token.Span
+}
+
+func (s IndexAssignment) Span() token.Span { return s.span }
+
+type If struct {
+	Condition Expression
+	Body      []Statement
+	// Else is nil when there is no else branch. An else-if is an else branch holding a single If.
+	Else []Statement
+	span token.Span
+}
+
+func (s If) Span() token.Span { return s.span }
+
+type While struct {
+	Condition Expression
+	Body      []Statement
+	span      token.Span
 }
+
+func (s While) Span() token.Span { return s.span }
+
+type For struct {
+	// Init, Condition and Post are nil when left out.
+	// A missing condition loops until a break or return.
+	Init      Statement
+	Condition Expression
+	Post      Statement
+	Body      []Statement
+	span      token.Span
+}
+
+func (s For) Span() token.Span { return s.span }
+
+// ForEach loops over the elements of a list, like for (var x in list) { ... }.
+type ForEach struct {
+	// Var declares the loop variable, which holds the element of the current iteration. It has no value.
+	Var  VarDecl
+	List Expression
+	Body []Statement
+	span token.Span
+}
+
+func (s ForEach) Span() token.Span { return s.span }
+
+// Block is a brace-enclosed list of statements with a scope of its own.
+type Block struct {
+	Body []Statement
+	span token.Span
+}
+
+func (s Block) Span() token.Span { return s.span }
+
+type Break struct {
+	span token.Span
+}
+
+func (s Break) Span() token.Span { return s.span }
+
+type Continue struct {
+	span token.Span
+}
+
+func (s Continue) Span() token.Span { return s.span }
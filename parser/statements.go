@@ -2,8 +2,10 @@ package parser
 
 import (
 	"fmt"
+	"leoscript/diag"
 	"leoscript/token"
 	"leoscript/types"
+	"strings"
 )
 
 func (p *Parser) ParseStatement() (Statement, error) {
@@ -11,31 +13,107 @@ func (p *Parser) ParseStatement() (Statement, error) {
 
 	switch tk.(type) {
 	case token.EOF:
-		return nil, fmt.Errorf("unexpected EOF")
+		return nil, p.errorf("unexpected EOF")
 	case token.Semicolon:
-		return nil, fmt.Errorf("unexpected semicolon")
-	case token.VarDecl, token.Type:
-		varDecl, err := p.parseVarDecl()
-		if err == nil {
-			p.scope.RegisterVar(varDecl)
-		}
-		p.putBack() // Put back semicolon. // TODO Fix this
-		return varDecl, err
+		return nil, p.errorf("unexpected semicolon")
+	case token.VarDecl, token.Type, token.Const, token.OpenBracket:
+		return p.parseLocalVarDecl()
+	case token.FnDef:
+		// A statement starting with a function type declares a variable, functions are only declared at the top level
+		if _, ok := p.peekNext().(token.OpenParen); !ok {
+			return nil, p.errorf("unexpected %v", tk.Type())
+		}
+		return p.parseLocalVarDecl()
 	case token.Identifier:
 		if _, ok := p.peekNext().(token.OpenParen); ok {
-			return p.parseFnCall()
+			return p.parseCallStmt()
 		}
 		return p.parseAssignment()
 	case token.Return:
 		return p.parseReturn()
+	case token.If:
+		return p.parseIf()
+	case token.While:
+		return p.parseWhile()
+	case token.For:
+		return p.parseFor()
+	case token.OpenBrace:
+		return p.parseBlockStmt()
+	case token.Break:
+		if p.loopDepth == 0 {
+			return nil, diag.Errorf(diag.CodeOutsideLoop, tk.Span(), "break is not in a loop")
+		}
+		return Break{span: tk.Span()}, nil
+	case token.Continue:
+		if p.loopDepth == 0 {
+			return nil, diag.Errorf(diag.CodeOutsideLoop, tk.Span(), "continue is not in a loop")
+		}
+		return Continue{span: tk.Span()}, nil
 	default:
-		return nil, fmt.Errorf("unexpected token type %T", tk)
+		return nil, p.errorf("unexpected %v", tk.Type())
+	}
+}
+
+// parseLocalVarDecl parses a variable declaration and declares the variable in the current scope.
+func (p *Parser) parseLocalVarDecl() (Statement, error) {
+	varDecl, err := p.parseVarDecl()
+	if err == nil {
+		if regErr := p.scope.RegisterVar(varDecl); regErr != nil {
+			prev, _ := p.scope.ResolveVar(varDecl.Name)
+			err = diag.Errorf(diag.CodeRedeclared, varDecl.Span(), "%v", regErr).
+				WithNote(prev.Span(), "previous declaration of %s", prev.Name)
+		} else {
+			p.checkShadowing(varDecl)
+		}
 	}
+	p.putBack() // Put back semicolon. // TODO Fix this
+	return varDecl, err
+}
+
+// checkShadowing warns when a variable declared in a block shadows a variable of an enclosing block.
+// Shadowing is allowed, and the variable is visible up to the end of the block,
+// but it is easily mistaken for an assignment. Shadowing a global is not warned about.
+func (p *Parser) checkShadowing(decl VarDecl) {
+	if p.scope.parent == nil {
+		return
+	}
+
+	prev, s, ok := p.scope.parent.lookupVar(decl.Name)
+	if !ok || s == p.globals {
+		return
+	}
+
+	d := diag.Warningf(diag.CodeShadowed, decl.Span(), "declaration of %s shadows a variable of an enclosing block", decl.Name)
+	if prev.Span().Start.IsValid() {
+		d = d.WithNote(prev.Span(), "shadowed declaration of %s", prev.Name)
+	}
+	p.diags.Add(d)
+}
+
+// parseBlockStmt parses a free-standing block starting at the current open brace.
+// The parser is left on the closing brace.
+func (p *Parser) parseBlockStmt() (Statement, error) {
+	openTk := p.peek()
+
+	p.next() // Consume the open brace
+
+	parentScope := p.scope
+	p.scope = NewScope(parentScope)
+	defer func() { p.scope = parentScope }()
+
+	body := p.parseBlock()
+
+	return Block{
+		Body: body,
+		span: openTk.Span().Join(p.peek().Span()),
+	}, nil
 }
 
 func (p *Parser) parseReturn() (Statement, error) {
+	returnTk := p.peek()
+
 	if _, ok := p.peekNext().(token.Semicolon); ok {
-		return Return{}, nil
+		return Return{span: returnTk.Span()}, nil
 	}
 
 	p.next() // Consume the return token
@@ -44,25 +122,272 @@ func (p *Parser) parseReturn() (Statement, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse return expression: %w", err)
 	}
+	expr = withType(expr, p.returnType)
 
 	if _, ok := p.peekNext().(token.Semicolon); !ok {
-		return nil, fmt.Errorf("expected semicolon after return expression")
+		return nil, errorAt(p.peekNext().Span(), "expected semicolon after return expression")
 	}
 
 	return Return{
 		Value: expr,
+		span:  returnTk.Span().Join(expr.Span()),
+	}, nil
+}
+
+func (p *Parser) parseIf() (Statement, error) {
+	ifTk := p.peek()
+
+	if err := p.expect(token.OpenParenType); err != nil {
+		return nil, fmt.Errorf("expected open parenthesis after if: %w", err)
+	}
+
+	p.next() // Consume the open parenthesis
+
+	cond, err := p.ParseExpr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse if condition: %w", err)
+	}
+
+	if err := p.expect(token.CloseParenType); err != nil {
+		return nil, fmt.Errorf("expected close parenthesis after if condition: %w", err)
+	}
+
+	body, err := p.parseNestedBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse if body: %w", err)
+	}
+
+	ifStmt := If{
+		Condition: cond,
+		Body:      body,
+		span:      ifTk.Span().Join(p.peek().Span()),
+	}
+
+	if _, ok := p.peekNext().(token.Else); !ok {
+		return ifStmt, nil
+	}
+
+	p.next() // Consume the else token
+
+	if _, ok := p.peekNext().(token.If); ok {
+		p.next() // Move to the if token of the else-if
+
+		elseIf, err := p.parseIf()
+		if err != nil {
+			return nil, err
+		}
+
+		ifStmt.Else = []Statement{elseIf}
+	} else {
+		ifStmt.Else, err = p.parseNestedBlock()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse else body: %w", err)
+		}
+	}
+
+	ifStmt.span = ifStmt.span.Join(p.peek().Span())
+
+	return ifStmt, nil
+}
+
+func (p *Parser) parseWhile() (Statement, error) {
+	whileTk := p.peek()
+
+	if err := p.expect(token.OpenParenType); err != nil {
+		return nil, fmt.Errorf("expected open parenthesis after while: %w", err)
+	}
+
+	p.next() // Consume the open parenthesis
+
+	cond, err := p.ParseExpr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse while condition: %w", err)
+	}
+
+	if err := p.expect(token.CloseParenType); err != nil {
+		return nil, fmt.Errorf("expected close parenthesis after while condition: %w", err)
+	}
+
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse while body: %w", err)
+	}
+
+	return While{
+		Condition: cond,
+		Body:      body,
+		span:      whileTk.Span().Join(p.peek().Span()),
 	}, nil
 }
 
+func (p *Parser) parseFor() (Statement, error) {
+	forTk := p.peek()
+
+	if err := p.expect(token.OpenParenType); err != nil {
+		return nil, fmt.Errorf("expected open parenthesis after for: %w", err)
+	}
+
+	if p.isForEach() {
+		return p.parseForEach(forTk)
+	}
+
+	// Variables declared in the init statement are only visible inside the loop
+	parentScope := p.scope
+	p.scope = NewScope(parentScope)
+	defer func() { p.scope = parentScope }()
+
+	forStmt := For{}
+
+	if _, ok := p.peekNext().(token.Semicolon); !ok {
+		p.next() // Consume the open parenthesis
+
+		init, err := p.ParseStatement()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse for init statement: %w", err)
+		}
+		forStmt.Init = init
+	}
+
+	if err := p.expect(token.SemicolonType); err != nil {
+		return nil, fmt.Errorf("expected semicolon after for init statement: %w", err)
+	}
+
+	if _, ok := p.peekNext().(token.Semicolon); !ok {
+		p.next() // Consume the semicolon
+
+		cond, err := p.ParseExpr()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse for condition: %w", err)
+		}
+		forStmt.Condition = cond
+	}
+
+	if err := p.expect(token.SemicolonType); err != nil {
+		return nil, fmt.Errorf("expected semicolon after for condition: %w", err)
+	}
+
+	if _, ok := p.peekNext().(token.CloseParen); !ok {
+		p.next() // Consume the semicolon
+
+		post, err := p.ParseStatement()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse for post statement: %w", err)
+		}
+		forStmt.Post = post
+	}
+
+	if err := p.expect(token.CloseParenType); err != nil {
+		return nil, fmt.Errorf("expected close parenthesis after for clauses: %w", err)
+	}
+
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse for body: %w", err)
+	}
+
+	forStmt.Body = body
+	forStmt.span = forTk.Span().Join(p.peek().Span())
+
+	return forStmt, nil
+}
+
+// parseLoopBody parses the body of a loop, in which break and continue are allowed.
+func (p *Parser) parseLoopBody() ([]Statement, error) {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseNestedBlock()
+}
+
+// parseNestedBlock parses a brace-enclosed block following the current token in a new scope.
+// The parser is left on the closing brace.
+func (p *Parser) parseNestedBlock() ([]Statement, error) {
+	if err := p.expect(token.OpenBraceType); err != nil {
+		return nil, fmt.Errorf("expected open brace: %w", err)
+	}
+
+	p.next() // Consume the open brace
+
+	parentScope := p.scope
+	p.scope = NewScope(parentScope)
+	defer func() { p.scope = parentScope }()
+
+	return p.parseBlock(), nil
+}
+
+// parseAssignment parses an assignment to a variable declared earlier, or to an element of a list.
 func (p *Parser) parseAssignment() (Statement, error) {
 	identifier := p.peek().(token.Identifier)
 
+	if _, ok := p.peekNext().(token.OpenBracket); ok {
+		return p.parseIndexAssignment()
+	}
+
+	// The variable is read by compound assignments, otherwise it only has to be declared
+	target, err := p.resolveIdentifier(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	decl, ok := p.scope.ResolveVar(identifier.Value)
+	if !ok {
+		fn, _ := p.scope.ResolveFn(identifier.Value)
+		return nil, diag.Errorf(diag.CodeConstAssign, identifier.Span(), "cannot assign to function %s", fn.Name).
+			WithNote(fn.Span(), "%s is declared here", fn.Name)
+	}
+
+	if decl.Const {
+		return nil, diag.Errorf(diag.CodeConstAssign, identifier.Span(), "cannot assign to constant %s", decl.Name).
+			WithNote(decl.Span(), "%s is declared here", decl.Name)
+	}
+
+	value, err := p.parseAssignedValue(target)
+	if err != nil {
+		return nil, err
+	}
+
+	return Assignment{
+		Name:  identifier.Value,
+		Value: value,
+		span:  identifier.Span().Join(value.Span()),
+	}, nil
+}
+
+// parseAssignedValue parses the assignment operator following the target of an assignment and the value assigned.
+// Compound assignments like a += b and the increments a++ and a-- are turned into a plain assignment
+// of the operation, a = a + b, so that they are checked and executed like one.
+func (p *Parser) parseAssignedValue(target Expression) (Expression, error) {
+	op, expr, err := p.parseAssignOp(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if op != "" {
+		return BinaryExpression{Left: target, Right: expr, Op: op}, nil
+	}
+
+	return expr, nil
+}
+
+// parseAssignOp parses the assignment operator following the target of an assignment and its operand.
+// The operator is empty for a plain assignment, otherwise it is the operation done on the target,
+// like + for a += b, or a++ whose operand is 1.
+func (p *Parser) parseAssignOp(target Expression) (string, Expression, error) {
 	if err := p.expect(token.OperatorType); err != nil {
-		return nil, fmt.Errorf("expected assignment operator after identifier: %w", err)
+		return "", nil, fmt.Errorf("expected assignment operator after identifier: %w", err)
 	}
 
-	if op := p.peek().(token.Operator).Op; op != "=" {
-		return nil, fmt.Errorf("expected assignment operator, got %v", op)
+	opTk := p.peek().(token.Operator)
+
+	var op string
+	switch opTk.Op {
+	case "=":
+	case "+=", "-=", "*=", "/=":
+		op = strings.TrimSuffix(opTk.Op, "=")
+	case "++", "--":
+		return opTk.Op[:1], IntegerLiteral{Value: 1, span: opTk.Span()}, nil
+	default:
+		return "", nil, p.errorf("expected assignment operator, got %v", opTk.Op)
 	}
 
 	p.next() // Consume the assignment operator
@@ -70,17 +395,14 @@ func (p *Parser) parseAssignment() (Statement, error) {
 	// Parse the expression on the right side of the assignment
 	expr, err := p.ParseExpr()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse right hand expression: %w", err)
+		return "", nil, fmt.Errorf("failed to parse right hand expression: %w", err)
 	}
 
-	if err := p.expect(token.SemicolonType); err != nil {
-		return nil, fmt.Errorf("expected semicolon after identifier: %w", err)
+	if op != "" {
+		return op, expr, nil
 	}
 
-	return Assignment{
-		Name:  identifier.Value,
-		Value: expr,
-	}, nil
+	return "", withType(expr, target.ReturnType()), nil
 }
 
 func (p *Parser) parseFnParams() ([]Argument, error) {
@@ -91,18 +413,18 @@ func (p *Parser) parseFnParams() ([]Argument, error) {
 
 	args := make([]Argument, 0)
 	for {
-		if err := p.expect(token.TypeType); err != nil {
+		p.next() // Move past the open parenthesis or comma
+
+		argType, err := p.parseType()
+		if err != nil {
 			return nil, fmt.Errorf("expected type in argument list: %w", err)
 		}
 
-		argType := p.peek().(token.Type).Kind
-
-		if err := p.expect(token.IdentifierType); err != nil {
+		identifier, err := p.expectName()
+		if err != nil {
 			return nil, fmt.Errorf("expected identifier after type in argument list: %w", err)
 		}
 
-		identifier := p.peek().(token.Identifier)
-
 		args = append(args, Argument{
 			Name: identifier.Value,
 			Type: argType,
@@ -121,12 +443,13 @@ func (p *Parser) parseFnParams() ([]Argument, error) {
 }
 
 func (p *Parser) parseFnDef() (FnDef, error) {
-	if err := p.expect(token.IdentifierType); err != nil {
+	fnTk := p.peek().(token.FnDef)
+
+	identifier, err := p.expectName()
+	if err != nil {
 		return FnDef{}, fmt.Errorf("expected identifier after fn: %w", err)
 	}
 
-	identifier := p.peek().(token.Identifier)
-
 	if err := p.expect(token.OpenParenType); err != nil {
 		return FnDef{}, fmt.Errorf("expected open parenthesis after identifier: %w", err)
 	}
@@ -141,19 +464,14 @@ func (p *Parser) parseFnDef() (FnDef, error) {
 		return FnDef{}, fmt.Errorf("expected close parenthesis after open parenthesis: %w", err)
 	}
 
-	var returnType types.Type
-
-	// Check if the function has a return type
-	if tk, ok := p.next().(token.Type); ok {
-		returnType = tk.Kind
-		p.next() // Consume the type token
-	} else {
-		// No return type is specified
-		returnType = types.Void
+	returnType, err := p.parseReturnType()
+	if err != nil {
+		return FnDef{}, err
 	}
+	p.next()
 
 	if _, ok := p.peek().(token.OpenBrace); !ok {
-		return FnDef{}, fmt.Errorf("expected open brace after arguments in function definition")
+		return FnDef{}, p.errorf("expected open brace after arguments in function definition")
 	}
 
 	// Consume the opening brace
@@ -170,10 +488,88 @@ func (p *Parser) parseFnDef() (FnDef, error) {
 		Name:       identifier.Value,
 		ReturnType: returnType,
 		Args:       args,
+		Doc:        fnTk.Doc,
 		bodySrc:    bodySrc,
+		span:       fnTk.Span().Join(p.peek().Span()),
 	}, nil
 }
 
+// parseReturnType parses the return type following the parameters of a function, if there is one.
+// The parser is left on the last token of the type, or on the close parenthesis of the parameters
+// when there is no return type and the function is void.
+func (p *Parser) parseReturnType() (types.Type, error) {
+	if !startsType(p.peekNext()) {
+		return types.Void, nil
+	}
+
+	p.next() // Move to the type
+	return p.parseType()
+}
+
+// startsType reports whether a type can start with the token.
+func startsType(tk token.Token) bool {
+	switch tk.(type) {
+	case token.Type, token.FnDef, token.OpenBracket:
+		return true
+	}
+
+	return false
+}
+
+// parseType parses the type starting at the current token, a basic type like int, a list type like []int
+// or a function type like fn(int, bool) string. The parser is left on the last token of the type.
+func (p *Parser) parseType() (types.Type, error) {
+	switch tk := p.peek().(type) {
+	case token.Type:
+		return tk.Kind, nil
+
+	case token.OpenBracket:
+		if err := p.expect(token.CloseBracketType); err != nil {
+			return nil, fmt.Errorf("expected close bracket in list type: %w", err)
+		}
+
+		p.next() // Move to the element type
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+
+		return types.List(elem), nil
+
+	case token.FnDef:
+		if err := p.expect(token.OpenParenType); err != nil {
+			return nil, fmt.Errorf("expected open parenthesis in function type: %w", err)
+		}
+
+		params := []types.Type{}
+		for p.peekNext().Type() != token.CloseParenType {
+			if len(params) > 0 {
+				if err := p.expect(token.CommaType); err != nil {
+					return nil, fmt.Errorf("expected comma between parameter types: %w", err)
+				}
+			}
+
+			p.next() // Move to the parameter type
+			param, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, param)
+		}
+
+		p.next() // Move to the close parenthesis
+
+		returnType, err := p.parseReturnType()
+		if err != nil {
+			return nil, err
+		}
+
+		return types.Func(params, returnType), nil
+	}
+
+	return nil, p.errorf("expected type, got %v", p.peek().Type())
+}
+
 func (p *Parser) getFnBodySource() ([]token.Token, error) {
 	bodySource := make([]token.Token, 0)
 	scopeDepth := 1
@@ -185,7 +581,7 @@ func (p *Parser) getFnBodySource() ([]token.Token, error) {
 		case token.CloseBrace:
 			scopeDepth--
 		case token.EOF:
-			return nil, fmt.Errorf("unexpected EOF")
+			return nil, errorAt(tk.Span(), "unexpected EOF")
 		}
 
 		bodySource = append(bodySource, tk)
@@ -199,56 +595,102 @@ func (p *Parser) getFnBodySource() ([]token.Token, error) {
 }
 
 func (p *Parser) parseVarDecl() (VarDecl, error) {
+	decl, err := p.parseVarDeclHeader()
+	if err != nil {
+		return VarDecl{}, err
+	}
+
+	p.next() // Consume the assignment operator
+
+	// Parse the expression on the right side of the assignment
+	expr, err := p.ParseExpr()
+	if err != nil {
+		return VarDecl{}, fmt.Errorf("failed to parse right hand expression: %w", err)
+	}
+
+	if decl.Const {
+		if expr, err = p.constValue(expr); err != nil {
+			return VarDecl{}, err
+		}
+	}
+
+	// If no type is specified, use the type of the expression.
+	// A specified type is verified against the expression by the type checker.
+	if decl, err = decl.inferType(expr); err != nil {
+		return VarDecl{}, err
+	}
+
+	if err := p.expect(token.SemicolonType); err != nil {
+		return VarDecl{}, fmt.Errorf("expected semicolon after identifier: %w", err)
+	}
+
+	decl.span = decl.span.Join(p.peek().Span())
+	return decl, nil
+}
+
+// parseVarDeclHeader parses the type, var or const keyword and the name of a variable declaration.
+// The type is nil when it is to be inferred from the value. The parser is left on the assignment operator.
+func (p *Parser) parseVarDeclHeader() (VarDecl, error) {
+	declTk := p.peek()
 	var varType types.Type
+	isConst := false
 
 	switch tk := p.peek().(type) {
-	case token.Type:
-		varType = tk.Kind
+	case token.Type, token.FnDef, token.OpenBracket:
+		t, err := p.parseType()
+		if err != nil {
+			return VarDecl{}, err
+		}
+		varType = t
 	case token.VarDecl:
 		varType = nil
+	case token.Const:
+		isConst = true
+
+		// The type of a constant is optional
+		if startsType(p.peekNext()) {
+			p.next()
+			t, err := p.parseType()
+			if err != nil {
+				return VarDecl{}, err
+			}
+			varType = t
+		}
 	default:
 		panic(fmt.Sprintf("expected type or vardecl token, got %T", tk))
 	}
 
-	if err := p.expect(token.IdentifierType); err != nil {
+	identifier, err := p.expectName()
+	if err != nil {
 		return VarDecl{}, fmt.Errorf("expected identifier after intdef: %w", err)
 	}
 
-	identifier := p.peek().(token.Identifier)
-
 	if err := p.expect(token.OperatorType); err != nil {
 		return VarDecl{}, fmt.Errorf("expected assignment operator after identifier: %w", err)
 	}
 
 	if op := p.peek().(token.Operator).Op; op != "=" {
-		return VarDecl{}, fmt.Errorf("expected assignment operator, got %v", op)
-	}
-
-	p.next() // Consume the assignment operator
-
-	// Parse the expression on the right side of the assignment
-	expr, err := p.ParseExpr()
-	if err != nil {
-		return VarDecl{}, fmt.Errorf("failed to parse right hand expression: %w", err)
-	}
-
-	if varType != nil {
-		// If a type is specified, verify that the expression matches the type
-		if expr.ReturnType() != varType {
-			return VarDecl{}, fmt.Errorf("type mismatch: expected %v, got %v", varType, expr.ReturnType())
-		}
-	} else {
-		// If no type is specified, use the type of the expression
-		varType = expr.ReturnType()
-	}
-
-	if err := p.expect(token.SemicolonType); err != nil {
-		return VarDecl{}, fmt.Errorf("expected semicolon after identifier: %w", err)
+		return VarDecl{}, p.errorf("expected assignment operator, got %v", op)
 	}
 
 	return VarDecl{
 		Name:  identifier.Value,
 		Type:  varType,
-		Value: expr,
+		Const: isConst,
+		span:  declTk.Span(),
 	}, nil
 }
+
+// inferType sets the value of the declaration, and its type to the type of the value if none is specified.
+// The type of an empty list cannot be inferred, it must be specified.
+func (decl VarDecl) inferType(value Expression) (VarDecl, error) {
+	if decl.Type == nil {
+		decl.Type = value.ReturnType()
+		if decl.Type == nil {
+			return decl, diag.Errorf(diag.CodeTypeMismatch, value.Span(), "cannot infer the type of %s from its value, declare its type", decl.Name)
+		}
+	}
+
+	decl.Value = withType(value, decl.Type)
+	return decl, nil
+}
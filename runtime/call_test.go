@@ -0,0 +1,76 @@
+package runtime_test
+
+import (
+	"context"
+	"leoscript/runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Call(t *testing.T) {
+	load := func(t *testing.T, src string) *runtime.Interpreter {
+		i := runtime.New()
+		assert.NoError(t, i.LoadRaw(src))
+		return i
+	}
+
+	t.Run("Call a function many times", func(t *testing.T) {
+		i := load(t, `
+			var offset = 100;
+
+			fn onEvent(int x, bool negate) int {
+				if (negate) {
+					return offset - x;
+				}
+				return offset + x;
+			}
+		`)
+
+		resp, err := i.Call(context.Background(), "onEvent", runtime.Int(5), runtime.Bool(false))
+		assert.NoError(t, err)
+		assert.Equal(t, runtime.Int(105), resp)
+
+		resp, err = i.Call(context.Background(), "onEvent", runtime.Int(5), runtime.Bool(true))
+		assert.NoError(t, err)
+		assert.Equal(t, runtime.Int(95), resp)
+	})
+
+	t.Run("Void function", func(t *testing.T) {
+		i := load(t, `fn main() {}`)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("Library script without main", func(t *testing.T) {
+		i := load(t, `fn lib() int { return 1; }`)
+
+		_, err := i.Run(context.Background())
+		assert.True(t, runtime.IsKind(err, runtime.UndefinedFunction))
+		assert.EqualError(t, err, "function main not defined")
+	})
+
+	t.Run("Wrong arguments", func(t *testing.T) {
+		i := load(t, `fn f(int a) int { return a; }`)
+
+		_, err := i.Call(context.Background(), "f")
+		assert.True(t, runtime.IsKind(err, runtime.ArityMismatch))
+		assert.EqualError(t, err, "1:1: f expects 1 arguments, got 0")
+
+		_, err = i.Call(context.Background(), "f", runtime.Bool(true))
+		assert.True(t, runtime.IsKind(err, runtime.TypeMismatch))
+		assert.EqualError(t, err, "1:1: argument 1 of f must be int, got bool")
+	})
+
+	t.Run("Cancelled context", func(t *testing.T) {
+		i := load(t, `fn f() int { return 1; }`)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := i.Call(ctx, "f")
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
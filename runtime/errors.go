@@ -0,0 +1,138 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"leoscript/token"
+	"strings"
+)
+
+//go:generate go run golang.org/x/tools/cmd/stringer -type=ErrorKind
+
+// ErrorKind classifies a runtime error.
+type ErrorKind int
+
+const (
+	_ ErrorKind = iota
+
+	// A bug in the interpreter rather than in the script
+	Internal
+
+	DivisionByZero
+	TypeMismatch
+	ArityMismatch
+	UndefinedVariable
+	UndefinedFunction
+	Redeclared
+
+	// A host function returned an error
+	HostError
+
+	// The context was cancelled, Err holds the reason
+	Cancelled
+	StepLimitExceeded
+	CallDepthExceeded
+	AllocationLimitExceeded
+
+	// An index or slice bounds outside of a list
+	IndexOutOfRange
+)
+
+// StackFrame is one function call in the LeoScript call stack of a runtime error.
+type StackFrame struct {
+	Function string
+	// Pos is where execution was in the function, the call of the next frame or the error itself.
+	Pos token.Position
+}
+
+// Error is an error raised while executing a script.
+type Error struct {
+	Kind    ErrorKind
+	Message string
+	Pos     token.Position
+	// Stack is the LeoScript call stack at the time of the error, the innermost call first.
+	Stack []StackFrame
+	// Err is the underlying error for HostError and Cancelled.
+	Err error
+}
+
+func (e *Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%v: %s", e.Pos, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// StackTrace formats the error followed by the LeoScript call stack, one call per line.
+func (e *Error) StackTrace() string {
+	sb := strings.Builder{}
+	sb.WriteString(e.Error())
+
+	for _, f := range e.Stack {
+		fmt.Fprintf(&sb, "\n\tat %s (%v)", f.Function, f.Pos)
+	}
+
+	return sb.String()
+}
+
+// IsKind reports whether err is a runtime error of the given kind.
+func IsKind(err error, kind ErrorKind) bool {
+	var rtErr *Error
+	return errors.As(err, &rtErr) && rtErr.Kind == kind
+}
+
+// fail aborts the execution of the script with a runtime error located at span.
+// The error is recovered and returned by the exported entry points of the interpreter.
+func (intr *Interpreter) fail(kind ErrorKind, span token.Span, format string, args ...any) {
+	panic(intr.newError(kind, span.Start, fmt.Sprintf(format, args...)))
+}
+
+func (intr *Interpreter) newError(kind ErrorKind, pos token.Position, msg string) *Error {
+	return &Error{
+		Kind:    kind,
+		Message: msg,
+		Pos:     pos,
+		Stack:   intr.stack(pos),
+	}
+}
+
+// stack returns the current call stack, innermost call first, with the innermost call located at pos.
+func (intr *Interpreter) stack(pos token.Position) []StackFrame {
+	stack := make([]StackFrame, 0, len(intr.frames))
+
+	for i := len(intr.frames) - 1; i >= 0; i-- {
+		f := intr.frames[i]
+		stack = append(stack, StackFrame{Function: f.fn.Name, Pos: pos})
+		pos = f.callSite.Start
+	}
+
+	return stack
+}
+
+// recoverError converts a panic raised during execution into an error stored in err.
+// Runtime errors are returned as they are, anything else is a bug in the interpreter and becomes an Internal error.
+// It must be deferred directly by the exported entry points, with the depth of the call stack and the scope
+// that was active when they were entered. A host function may call back into the interpreter during a call,
+// and the failure of that inner call must leave the frames of the outer one in place.
+func (intr *Interpreter) recoverError(err *error, depth int, activeScope *scope) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	rtErr, ok := r.(*Error)
+	if !ok {
+		rtErr = intr.newError(Internal, token.Position{}, fmt.Sprintf("internal error: %v", r))
+	}
+
+	// The frames have already been unwound by the deferred cleanup in callFunction, this is just a safety net.
+	intr.frames = intr.frames[:min(depth, len(intr.frames))]
+	intr.activeScope = activeScope
+
+	*err = rtErr
+}
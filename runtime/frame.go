@@ -0,0 +1,43 @@
+package runtime
+
+import (
+	"leoscript/parser"
+	"leoscript/token"
+)
+
+// frame holds the state of a single function call.
+type frame struct {
+	fn parser.FnDef
+
+	// locals is the scope of the function body, holding the arguments.
+	// Blocks in the body create child scopes of it.
+	locals *scope
+
+	// returnVal is set by the return statement that ends the call.
+	returnVal Value
+
+	// callSite is the location of the call expression. It is not set for calls made by the host.
+	callSite token.Span
+
+	// callerScope is the scope that was active when the call was made, restored when the call returns.
+	callerScope *scope
+}
+
+func (intr *Interpreter) pushFrame(f *frame) {
+	intr.frames = append(intr.frames, f)
+}
+
+func (intr *Interpreter) popFrame() *frame {
+	f := intr.frames[len(intr.frames)-1]
+	intr.frames = intr.frames[:len(intr.frames)-1]
+	return f
+}
+
+// currentFrame returns the frame of the function currently executing, or nil outside of any function.
+func (intr *Interpreter) currentFrame() *frame {
+	if len(intr.frames) == 0 {
+		return nil
+	}
+
+	return intr.frames[len(intr.frames)-1]
+}
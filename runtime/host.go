@@ -0,0 +1,79 @@
+package runtime
+
+import (
+	"fmt"
+	"leoscript/parser"
+	"leoscript/token"
+	"leoscript/types"
+)
+
+// Signature describes the parameters and return type of a host function.
+// A void function has types.Void as its return type.
+type Signature struct {
+	Args       []types.Type
+	ReturnType types.Type
+}
+
+// HostFunc is a Go function that can be called from a script.
+// The arguments are guaranteed to match the signature it was registered with.
+// A returned error aborts the script with a HostError.
+type HostFunc func(args []Value) (Value, error)
+
+type hostFunction struct {
+	def parser.FnDef
+	fn  HostFunc
+}
+
+// RegisterHostFunc makes fn callable from scripts under the given name.
+// Calls are type checked against the signature when the script is loaded,
+// so host functions must be registered before LoadRaw or LoadFile.
+func (intr *Interpreter) RegisterHostFunc(name string, sig Signature, fn HostFunc) error {
+	if _, ok := intr.hostFuncs[name]; ok {
+		return fmt.Errorf("host function %s already registered", name)
+	}
+
+	if sig.ReturnType == nil {
+		sig.ReturnType = types.Void
+	}
+
+	args := make([]parser.Argument, 0, len(sig.Args))
+	for i, argType := range sig.Args {
+		args = append(args, parser.Argument{Name: fmt.Sprintf("arg%d", i), Type: argType})
+	}
+
+	intr.hostFuncs[name] = hostFunction{
+		def: parser.FnDef{Name: name, Args: args, ReturnType: sig.ReturnType},
+		fn:  fn,
+	}
+
+	return nil
+}
+
+// hostScope returns a parser scope declaring all registered host functions.
+func (intr *Interpreter) hostScope() *parser.Scope {
+	s := parser.NewScope(nil)
+	for _, host := range intr.hostFuncs {
+		s.RegisterFn(host.def)
+	}
+
+	return s
+}
+
+func (intr *Interpreter) callHost(host hostFunction, parameters []Value, callSite token.Span) Value {
+	if len(parameters) != len(host.def.Args) {
+		intr.fail(ArityMismatch, callSite, "%s expects %d arguments, got %d", host.def.Name, len(host.def.Args), len(parameters))
+	}
+
+	val, err := host.fn(parameters)
+	if err != nil {
+		rtErr := intr.newError(HostError, callSite.Start, fmt.Sprintf("%s: %v", host.def.Name, err))
+		rtErr.Err = err
+		panic(rtErr)
+	}
+
+	if typeOf(val) != host.def.ReturnType {
+		intr.fail(TypeMismatch, callSite, "host function %s returned %v, expected %v", host.def.Name, typeOf(val), host.def.ReturnType)
+	}
+
+	return val
+}
@@ -0,0 +1,211 @@
+package runtime_test
+
+import (
+	"context"
+	"errors"
+	"leoscript/runtime"
+	"leoscript/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HostFunctions(t *testing.T) {
+	t.Run("Call a host function", func(t *testing.T) {
+		i := runtime.New()
+
+		var called []int64
+		err := i.RegisterHostFunc("add", runtime.Signature{
+			Args:       []types.Type{types.Int, types.Int},
+			ReturnType: types.Int,
+		}, func(args []runtime.Value) (runtime.Value, error) {
+			a, _ := args[0].AsInt()
+			b, _ := args[1].AsInt()
+			called = append(called, a, b)
+			return runtime.Int(a + b), nil
+		})
+		assert.NoError(t, err)
+
+		err = i.LoadRaw(`
+			fn main() int {
+				return add(1, 2) * 10;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, runtime.Int(30), resp)
+		assert.Equal(t, []int64{1, 2}, called)
+	})
+
+	t.Run("Lists are passed to and from the host", func(t *testing.T) {
+		i := runtime.New()
+
+		err := i.RegisterHostFunc("split", runtime.Signature{
+			Args:       []types.Type{types.Int},
+			ReturnType: types.List(types.Int),
+		}, func(args []runtime.Value) (runtime.Value, error) {
+			n, _ := args[0].AsInt()
+			return runtime.FromNative([]int64{n / 10, n % 10})
+		})
+		assert.NoError(t, err)
+
+		err = i.LoadRaw(`
+			fn sum([]int list) int {
+				var total = 0;
+				for (var n in list) {
+					total += n;
+				}
+				return total;
+			}
+
+			fn main() int {
+				return sum(split(42));
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, runtime.Int(6), resp)
+
+		resp, err = i.Call(context.Background(), "sum", runtime.List(types.Int, runtime.Int(1), runtime.Int(2)))
+		assert.NoError(t, err)
+		assert.Equal(t, runtime.Int(3), resp)
+	})
+
+	t.Run("Void host function", func(t *testing.T) {
+		i := runtime.New()
+
+		var logged []bool
+		err := i.RegisterHostFunc("log", runtime.Signature{Args: []types.Type{types.Bool}}, func(args []runtime.Value) (runtime.Value, error) {
+			b, _ := args[0].AsBool()
+			logged = append(logged, b)
+			return nil, nil
+		})
+		assert.NoError(t, err)
+
+		err = i.LoadRaw(`
+			fn main() int {
+				log(1 < 2);
+				return 0;
+			}
+		`)
+		assert.NoError(t, err)
+
+		_, err = i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{true}, logged)
+	})
+
+	t.Run("Calls are checked when loading", func(t *testing.T) {
+		i := runtime.New()
+
+		err := i.RegisterHostFunc("double", runtime.Signature{
+			Args:       []types.Type{types.Int},
+			ReturnType: types.Int,
+		}, func(args []runtime.Value) (runtime.Value, error) { return args[0], nil })
+		assert.NoError(t, err)
+
+		err = i.LoadRaw(`
+			fn main() int {
+				var a = double(true);
+				return double(1, 2);
+			}
+		`)
+		assert.ErrorContains(t, err, "3:20: argument 1 of double must be int, got bool")
+		assert.ErrorContains(t, err, "4:12: double expects 1 arguments, got 2")
+	})
+
+	t.Run("Scripts cannot redeclare host functions", func(t *testing.T) {
+		i := runtime.New()
+
+		err := i.RegisterHostFunc("main", runtime.Signature{}, func([]runtime.Value) (runtime.Value, error) { return nil, nil })
+		assert.NoError(t, err)
+
+		err = i.LoadRaw(`fn main() {}`)
+		assert.ErrorContains(t, err, "1:1: function main already declared")
+	})
+
+	t.Run("Registering twice", func(t *testing.T) {
+		i := runtime.New()
+
+		fn := func([]runtime.Value) (runtime.Value, error) { return nil, nil }
+		assert.NoError(t, i.RegisterHostFunc("f", runtime.Signature{}, fn))
+		assert.ErrorContains(t, i.RegisterHostFunc("f", runtime.Signature{}, fn), "already registered")
+	})
+
+	t.Run("Host errors become runtime errors", func(t *testing.T) {
+		i := runtime.New()
+
+		errNotFound := errors.New("not found")
+		err := i.RegisterHostFunc("lookup", runtime.Signature{
+			Args:       []types.Type{types.Int},
+			ReturnType: types.Int,
+		}, func(args []runtime.Value) (runtime.Value, error) { return nil, errNotFound })
+		assert.NoError(t, err)
+
+		err = i.LoadFile("rules.leo", `fn main() int {
+	return lookup(5);
+}`)
+		assert.NoError(t, err)
+
+		_, err = i.Run(context.Background())
+		assert.True(t, runtime.IsKind(err, runtime.HostError))
+		assert.ErrorIs(t, err, errNotFound)
+		assert.EqualError(t, err, "rules.leo:2:9: lookup: not found")
+	})
+
+	t.Run("Host functions can call back into the script", func(t *testing.T) {
+		i := runtime.New()
+
+		err := i.RegisterHostFunc("cb", runtime.Signature{
+			Args:       []types.Type{types.Int},
+			ReturnType: types.Int,
+		}, func(args []runtime.Value) (runtime.Value, error) {
+			return i.Call(context.Background(), "inner", args[0])
+		})
+		assert.NoError(t, err)
+
+		err = i.LoadFile("rules.leo", `fn inner(int n) int {
+	return 10 / n;
+}
+
+fn main() int {
+	var a = cb(2);
+	return a + cb(0);
+}`)
+		assert.NoError(t, err)
+
+		_, err = i.Run(context.Background())
+		assert.True(t, runtime.IsKind(err, runtime.HostError))
+		assert.EqualError(t, err, "rules.leo:7:13: cb: rules.leo:2:9: division by zero")
+
+		var inner *runtime.Error
+		assert.True(t, errors.As(errors.Unwrap(err), &inner))
+		assert.Equal(t, runtime.DivisionByZero, inner.Kind)
+		assert.Equal(t, []string{"inner", "main"}, []string{inner.Stack[0].Function, inner.Stack[1].Function})
+
+		// The interpreter is left in a usable state
+		resp, err := i.Call(context.Background(), "inner", runtime.Int(5))
+		assert.NoError(t, err)
+		assert.Equal(t, runtime.Int(2), resp)
+	})
+
+	t.Run("Wrong return type from host", func(t *testing.T) {
+		i := runtime.New()
+
+		err := i.RegisterHostFunc("bad", runtime.Signature{ReturnType: types.Int}, func([]runtime.Value) (runtime.Value, error) {
+			return runtime.Bool(true), nil
+		})
+		assert.NoError(t, err)
+
+		err = i.LoadRaw(`fn main() int { return bad(); }`)
+		assert.NoError(t, err)
+
+		_, err = i.Run(context.Background())
+		assert.True(t, runtime.IsKind(err, runtime.TypeMismatch))
+		assert.ErrorContains(t, err, "host function bad returned bool, expected int")
+	})
+}
@@ -1,57 +1,141 @@
 package runtime
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"leoscript/diag"
 	"leoscript/lexer"
 	"leoscript/parser"
+	"leoscript/token"
+	"leoscript/typecheck"
 	"leoscript/types"
+	"strings"
 )
 
 func (intr *Interpreter) LoadRaw(src string) error {
+	return intr.LoadFile("", src)
+}
+
+// LoadFile works like LoadRaw, but positions in errors will refer to the given file name.
+func (intr *Interpreter) LoadFile(file, src string) error {
 	if src == "" {
 		return fmt.Errorf("empty source")
 	}
 
-	tokens, err := lexer.Tokenize(src)
-	if err != nil {
-		return fmt.Errorf("failed to tokenize: %w", err)
+	return intr.LoadReader(file, strings.NewReader(src))
+}
+
+// LoadReader works like LoadFile, but reads the source from r as it is parsed.
+// The source text is not held in memory, but its tokens are until the file is parsed, see parser.NewStreamParser.
+// The values of the top-level variables are computed without a deadline, use Load to bound them.
+func (intr *Interpreter) LoadReader(file string, r io.Reader) error {
+	return intr.Load(context.Background(), file, r)
+}
+
+// Load works like LoadReader, but the values of the top-level variables are computed under ctx
+// and the limits of the interpreter, like a call, so that a variable initialized by a runaway
+// function cannot block loading.
+func (intr *Interpreter) Load(ctx context.Context, file string, r io.Reader) error {
+	lx := lexer.NewFile(file, r)
+
+	// Parse and type check even if the lexer or the parser failed so that all problems in the source are reported at once.
+	var diags diag.Diagnostics
+
+	p := parser.NewStreamParser(lx, intr.hostScope())
+	program, err := p.ParseFile()
+	diags.AddError(err)
+	intr.warnings = p.Diagnostics().Warnings()
+	diags.AddError(typecheck.Check(program, intr.hostScope()))
+
+	if err := lx.Err(); err != nil {
+		var lexDiags diag.Diagnostics
+		if !errors.As(err, &lexDiags) {
+			return fmt.Errorf("reading %s: %w", file, err)
+		}
+		diags = append(diags, lexDiags...)
 	}
 
-	program, err := parser.NewParser(tokens, nil).ParseFile()
-	if err != nil {
-		return fmt.Errorf("failed to parse: %w", err)
+	diags.Sort()
+	if err := diags.Err(); err != nil {
+		return err
+	}
+
+	return intr.evaluateProgram(ctx, program)
+}
+
+// Warnings returns the warnings found when the source was last loaded, like variables shadowing others.
+// They do not prevent the source from running, and are also part of the error when loading failed.
+func (intr *Interpreter) Warnings() diag.Diagnostics {
+	return intr.warnings
+}
+
+// evaluateProgram declares the top-level functions and variables of the program.
+// The functions are declared first so that the values of the variables can call them,
+// then the variables are initialized in source order.
+func (intr *Interpreter) evaluateProgram(ctx context.Context, program parser.Program) (err error) {
+	defer intr.recoverError(&err, 0, intr.globalScope)
+
+	intr.startExecution(ctx)
+
+	for _, stmt := range program.Body {
+		if fn, ok := stmt.(parser.FnDef); ok {
+			intr.evaluateStatement(fn)
+		}
 	}
 
 	for _, stmt := range program.Body {
-		intr.evaluateStatement(stmt)
+		if _, ok := stmt.(parser.FnDef); !ok {
+			intr.evaluateStatement(stmt)
+		}
 	}
 
 	return nil
 }
 
-func (intr *Interpreter) Run() (val runtimeVal, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			val = nil
-			err = fmt.Errorf("panic: %v", r)
-		}
-	}()
+// Run calls the main function of the loaded program and returns its result.
+// Errors raised by the script are returned as *Error.
+func (intr *Interpreter) Run(ctx context.Context) (Value, error) {
+	return intr.Call(ctx, "main")
+}
 
-	for fnName, fnDef := range intr.activeScope.functions {
-		if fnName == "main" {
-			val = intr.callFunction(intr.activeScope, fnDef, nil)
-		}
+// Call calls the script function with the given name and returns its result, nil for void functions.
+// The arguments must match the parameters of the function.
+// The context is checked between statements, and the execution is bounded by the limits of the interpreter.
+// A call made by a host function is part of the running execution: it shares its limits
+// and is cancelled with its context as well as with ctx.
+// Errors raised by the script are returned as *Error.
+func (intr *Interpreter) Call(ctx context.Context, name string, args ...Value) (val Value, err error) {
+	defer intr.recoverError(&err, len(intr.frames), intr.activeScope)
+
+	// A call made by a host function is part of the execution that called the host function
+	if len(intr.frames) == 0 {
+		intr.startExecution(ctx)
+	} else {
+		defer intr.nestExecution(ctx)()
+	}
+	if ctx.Err() != nil {
+		intr.failCancelled(token.Position{})
 	}
 
-	if val == nil {
-		return nil, fmt.Errorf("main function not found")
+	fn, ok := intr.globalScope.GetFn(name)
+	if !ok {
+		return nil, intr.newError(UndefinedFunction, token.Position{}, fmt.Sprintf("function %s not defined", name))
 	}
 
-	if err != nil {
-		return nil, err
+	if len(args) != len(fn.Args) {
+		return nil, intr.newError(ArityMismatch, fn.Span().Start, fmt.Sprintf("%s expects %d arguments, got %d", name, len(fn.Args), len(args)))
+	}
+
+	for i, arg := range args {
+		if typeOf(arg) != fn.Args[i].Type {
+			return nil, intr.newError(TypeMismatch, fn.Span().Start, fmt.Sprintf("argument %d of %s must be %v, got %v", i+1, name, fn.Args[i].Type, typeOf(arg)))
+		}
 	}
 
-	return val, nil
+	return intr.callFunction(fn, args, token.Span{}), nil
 }
 
 func New() *Interpreter {
@@ -59,153 +143,509 @@ func New() *Interpreter {
 	return &Interpreter{
 		globalScope: globalScope,
 		activeScope: globalScope,
+		hostFuncs:   make(map[string]hostFunction),
+		limits:      DefaultLimits,
 	}
 }
 
 type Interpreter struct {
 	globalScope *scope
 	activeScope *scope
+
+	// frames is the call stack, the innermost call last.
+	frames []*frame
+
+	hostFuncs map[string]hostFunction
+
+	limits Limits
+	exec   execution
+
+	// warnings are the warnings found when loading the source, see Warnings.
+	warnings diag.Diagnostics
 }
 
-func (intr *Interpreter) evaluateStatement(stmt parser.Statement) {
+// control tells the enclosing statements how execution continues after a statement.
+type control int
+
+const (
+	// ctrlNext continues with the next statement.
+	ctrlNext control = iota
+	// ctrlReturn unwinds to the calling function.
+	ctrlReturn
+	// ctrlBreak exits the innermost loop.
+	ctrlBreak
+	// ctrlContinue skips to the next iteration of the innermost loop.
+	ctrlContinue
+)
+
+// evaluateStatement executes a single statement.
+// A return statement stores its value in the current frame before unwinding with ctrlReturn.
+func (intr *Interpreter) evaluateStatement(stmt parser.Statement) control {
+	intr.step(stmt.Span())
+
 	switch s := stmt.(type) {
 	case parser.VarDecl:
 		val := intr.evaluateExpression(s.Value)
 		if err := intr.activeScope.DeclareVar(s.Name, val); err != nil {
-			panic(err)
+			intr.fail(Redeclared, s.Span(), "%v", err)
 		}
+	case parser.Assignment:
+		val := intr.evaluateExpression(s.Value)
+		if err := intr.activeScope.SetVar(s.Name, val); err != nil {
+			intr.fail(UndefinedVariable, s.Span(), "%v", err)
+		}
+	case parser.IndexAssignment:
+		intr.evaluateIndexAssignment(s)
 	case parser.FnDef:
 		if err := intr.activeScope.RegisterFn(s.Name, s); err != nil {
-			panic(err)
+			intr.fail(Redeclared, s.Span(), "%v", err)
+		}
+	case parser.Call:
+		intr.evaluateExpression(s)
+	case parser.Return:
+		if s.Value != nil {
+			intr.currentFrame().returnVal = intr.evaluateExpression(s.Value)
+		}
+		return ctrlReturn
+	case parser.Break:
+		return ctrlBreak
+	case parser.Continue:
+		return ctrlContinue
+	case parser.If:
+		if intr.asBool(intr.evaluateExpression(s.Condition), s.Condition) {
+			return intr.evaluateBlock(s.Body)
+		}
+		return intr.evaluateBlock(s.Else)
+	case parser.While:
+		for intr.asBool(intr.evaluateExpression(s.Condition), s.Condition) {
+			ctrl := intr.evaluateBlock(s.Body)
+			intr.step(s.Span())
+			if ctrl == ctrlReturn {
+				return ctrl
+			}
+			if ctrl == ctrlBreak {
+				break
+			}
 		}
+	case parser.For:
+		return intr.evaluateFor(s)
+	case parser.ForEach:
+		return intr.evaluateForEach(s)
+	case parser.Block:
+		return intr.evaluateBlock(s.Body)
 	default:
 		panic(fmt.Sprintf("unknown statement: %T, v=%+v", s, s))
 	}
+
+	return ctrlNext
 }
 
-func (intr *Interpreter) evaluateExpression(expr parser.Expression) runtimeVal {
-	switch e := expr.(type) {
-	case parser.BinaryExpression:
-		left := intr.evaluateExpression(e.Left)
-		right := intr.evaluateExpression(e.Right)
+func (intr *Interpreter) evaluateFor(s parser.For) control {
+	// The init statement gets its own scope so that the loop variable is not visible after the loop
+	parentScope := intr.activeScope
+	intr.activeScope = newScope(parentScope)
+	defer func() { intr.activeScope = parentScope }()
 
-		switch e.Op {
-		// Arithmetic
-		case "+":
-			return numberVal{value: left.(numberVal).value + right.(numberVal).value}
-		case "-":
-			return numberVal{value: left.(numberVal).value - right.(numberVal).value}
-		case "*":
-			return numberVal{value: left.(numberVal).value * right.(numberVal).value}
-		case "/":
-			if right.(numberVal).value == 0 {
-				panic("division by zero")
-			}
-			return numberVal{value: left.(numberVal).value / right.(numberVal).value}
-
-		// Boolean
-		case "&&":
-			return booleanVal{value: left.(booleanVal).value && right.(booleanVal).value}
-		case "||":
-			return booleanVal{value: left.(booleanVal).value || right.(booleanVal).value}
-		case "<":
-			return booleanVal{value: left.(numberVal).value < right.(numberVal).value}
-		case ">":
-			return booleanVal{value: left.(numberVal).value > right.(numberVal).value}
-		case "<=":
-			return booleanVal{value: left.(numberVal).value <= right.(numberVal).value}
-		case ">=":
-			return booleanVal{value: left.(numberVal).value >= right.(numberVal).value}
-
-		// Equality
-		case "==":
-			if left.Type() == types.Int {
-				return booleanVal{value: left.(numberVal).value == right.(numberVal).value}
-			}
-			return booleanVal{value: left.(booleanVal).value == right.(booleanVal).value}
-		case "!=":
-			if left.Type() == types.Int {
-				return booleanVal{value: left.(numberVal).value != right.(numberVal).value}
-			}
-			return booleanVal{value: left.(booleanVal).value != right.(booleanVal).value}
+	if s.Init != nil {
+		intr.evaluateStatement(s.Init)
+	}
 
-		default:
-			panic(fmt.Sprintf("unknown operator: %s", e.Op))
+	for s.Condition == nil || intr.asBool(intr.evaluateExpression(s.Condition), s.Condition) {
+		ctrl := intr.evaluateBlock(s.Body)
+		if ctrl == ctrlReturn {
+			return ctrl
+		}
+		if ctrl == ctrlBreak {
+			break
+		}
+
+		if s.Post != nil {
+			intr.evaluateStatement(s.Post)
+		}
+		intr.step(s.Span())
+	}
+
+	return ctrlNext
+}
+
+// evaluateBlock executes the statements in a new scope.
+// It stops at the first statement that does not continue with the next one and passes its control on.
+func (intr *Interpreter) evaluateBlock(stmts []parser.Statement) control {
+	parentScope := intr.activeScope
+	intr.activeScope = newScope(parentScope)
+	defer func() { intr.activeScope = parentScope }()
+
+	return intr.evaluateStatements(stmts)
+}
+
+// evaluateStatements executes the statements in the active scope.
+// It stops at the first statement that does not continue with the next one and passes its control on.
+func (intr *Interpreter) evaluateStatements(stmts []parser.Statement) control {
+	for _, stmt := range stmts {
+		if ctrl := intr.evaluateStatement(stmt); ctrl != ctrlNext {
+			return ctrl
 		}
+	}
+
+	return ctrlNext
+}
+
+func (intr *Interpreter) evaluateExpression(expr parser.Expression) Value {
+	switch e := expr.(type) {
+	case parser.BinaryExpression:
+		return intr.evaluateBinary(e)
 
 	case parser.UnaryExpression:
 		val := intr.evaluateExpression(e.Expression)
+		intr.alloc(e.Span())
 
 		switch e.Op {
 		case "-":
-			return numberVal{value: -val.(numberVal).value}
+			if f, ok := val.(floatVal); ok {
+				return floatVal{value: -f.value}
+			}
+			return numberVal{value: -intr.asInt(val, e.Expression)}
 		case "+":
-			return numberVal{value: val.(numberVal).value}
+			if f, ok := val.(floatVal); ok {
+				return f
+			}
+			return numberVal{value: intr.asInt(val, e.Expression)}
 		case "!":
-			return booleanVal{value: !val.(booleanVal).value}
+			return booleanVal{value: !intr.asBool(val, e.Expression)}
 		default:
 			panic(fmt.Sprintf("unknown operator: %s", e.Op))
 		}
 
 	case parser.IntegerLiteral:
+		intr.alloc(e.Span())
 		return numberVal{value: e.Value}
 
+	case parser.FloatLiteral:
+		intr.alloc(e.Span())
+		return floatVal{value: e.Value}
+
 	case parser.BooleanLiteral:
+		intr.alloc(e.Span())
 		return booleanVal{value: e.Value}
 
+	case parser.StringLiteral:
+		intr.alloc(e.Span())
+		return stringVal{value: e.Value}
+
 	case parser.Identifier:
-		val, ok := intr.activeScope.GetVar(e.Name)
-		if !ok {
-			// TODO: Handle this better
-			panic(fmt.Sprintf("variable %s not defined", e.Name))
+		if val, ok := intr.activeScope.GetVar(e.Name); ok {
+			return val
+		}
+
+		// A function used as a value
+		if fn, ok := intr.activeScope.GetFn(e.Name); ok {
+			return funcVal{fn: fn, env: intr.globalScope}
 		}
-		return val
+		if host, ok := intr.hostFuncs[e.Name]; ok {
+			return funcVal{fn: host.def, host: &host}
+		}
+
+		intr.fail(UndefinedVariable, e.Span(), "variable %s not defined", e.Name)
+		return nil
+
+	case parser.FnLiteral:
+		intr.alloc(e.Span())
+		return funcVal{fn: e.Fn, env: intr.activeScope}
 
 	case parser.Call:
-		fn, ok := intr.activeScope.GetFn(e.Name)
-		if !ok {
-			panic(fmt.Sprintf("function %s not defined", e.Name))
+		return intr.evaluateCall(e)
+
+	case parser.ListLiteral:
+		return intr.evaluateListLiteral(e)
+
+	case parser.IndexExpression:
+		return intr.evaluateIndex(e)
+
+	case parser.SliceExpression:
+		return intr.evaluateSlice(e)
+
+	case parser.BuiltinCall:
+		return intr.evaluateBuiltin(e)
+
+	default:
+		panic(fmt.Sprintf("unknown expression: %T, v=%+v", e, e))
+	}
+}
+
+func (intr *Interpreter) evaluateBinary(e parser.BinaryExpression) Value {
+	left := intr.evaluateExpression(e.Left)
+
+	// The right operand of && and || is only evaluated when the left one does not decide the result
+	if e.Op == "&&" && !intr.asBool(left, e.Left) || e.Op == "||" && intr.asBool(left, e.Left) {
+		intr.alloc(e.Span())
+		return left
+	}
+
+	right := intr.evaluateExpression(e.Right)
+
+	return intr.binaryOp(left, right, e)
+}
+
+// binaryOp applies the operator of e to the values of its operands, which are already evaluated.
+func (intr *Interpreter) binaryOp(left, right Value, e parser.BinaryExpression) Value {
+	intr.alloc(e.Span())
+
+	// An int is promoted to float when mixed with a float
+	if isFloatOperation(left, right) {
+		return intr.evaluateFloatBinary(left, right, e)
+	}
+
+	switch e.Op {
+	// Arithmetic
+	case "+":
+		if _, ok := left.(stringVal); ok {
+			l, r := intr.asString(left, e.Left), intr.asString(right, e.Right)
+			intr.allocData(e.Span(), len(l)+len(r))
+			return stringVal{value: l + r}
+		}
+		return numberVal{value: intr.asInt(left, e.Left) + intr.asInt(right, e.Right)}
+	case "-":
+		return numberVal{value: intr.asInt(left, e.Left) - intr.asInt(right, e.Right)}
+	case "*":
+		return numberVal{value: intr.asInt(left, e.Left) * intr.asInt(right, e.Right)}
+	case "/":
+		divisor := intr.asInt(right, e.Right)
+		if divisor == 0 {
+			intr.fail(DivisionByZero, e.Span(), "division by zero")
+		}
+		return numberVal{value: intr.asInt(left, e.Left) / divisor}
+
+	// Boolean
+	case "&&":
+		return booleanVal{value: intr.asBool(left, e.Left) && intr.asBool(right, e.Right)}
+	case "||":
+		return booleanVal{value: intr.asBool(left, e.Left) || intr.asBool(right, e.Right)}
+	case "<":
+		return booleanVal{value: intr.compare(left, right, e) < 0}
+	case ">":
+		return booleanVal{value: intr.compare(left, right, e) > 0}
+	case "<=":
+		return booleanVal{value: intr.compare(left, right, e) <= 0}
+	case ">=":
+		return booleanVal{value: intr.compare(left, right, e) >= 0}
+
+	// Equality
+	case "==":
+		return booleanVal{value: intr.equal(left, right, e)}
+	case "!=":
+		return booleanVal{value: !intr.equal(left, right, e)}
+
+	default:
+		panic(fmt.Sprintf("unknown operator: %s", e.Op))
+	}
+}
+
+// isFloatOperation reports whether an arithmetic operation or comparison is done on floats,
+// which is the case if one of the operands is a float.
+func isFloatOperation(left, right Value) bool {
+	_, leftFloat := left.(floatVal)
+	_, rightFloat := right.(floatVal)
+	return leftFloat || rightFloat
+}
+
+// evaluateFloatBinary evaluates a binary expression where at least one operand is a float.
+func (intr *Interpreter) evaluateFloatBinary(left, right Value, e parser.BinaryExpression) Value {
+	if e.Op == "==" || e.Op == "!=" {
+		if !isNumber(left) || !isNumber(right) {
+			intr.fail(TypeMismatch, e.Span(), "cannot compare %v with %v", typeOf(left), typeOf(right))
 		}
+	}
 
-		var parameters []runtimeVal
-		for _, arg := range e.Args {
-			parameters = append(parameters, intr.evaluateExpression(arg))
+	l := intr.asFloat(left, e.Left)
+	r := intr.asFloat(right, e.Right)
+
+	switch e.Op {
+	// Arithmetic
+	case "+":
+		return floatVal{value: l + r}
+	case "-":
+		return floatVal{value: l - r}
+	case "*":
+		return floatVal{value: l * r}
+	case "/":
+		if r == 0 {
+			intr.fail(DivisionByZero, e.Span(), "division by zero")
 		}
+		return floatVal{value: l / r}
+
+	// Comparison
+	case "<":
+		return booleanVal{value: l < r}
+	case ">":
+		return booleanVal{value: l > r}
+	case "<=":
+		return booleanVal{value: l <= r}
+	case ">=":
+		return booleanVal{value: l >= r}
+	case "==":
+		return booleanVal{value: l == r}
+	case "!=":
+		return booleanVal{value: l != r}
 
-		return intr.callFunction(intr.activeScope, fn, parameters)
+	default:
+		intr.fail(TypeMismatch, e.Span(), "operator %s is not defined for %v", e.Op, types.Float)
+		return nil
+	}
+}
 
+func isNumber(val Value) bool {
+	switch val.(type) {
+	case numberVal, floatVal:
+		return true
 	default:
-		panic(fmt.Sprintf("unknown expression: %T, v=%+v", e, e))
+		return false
 	}
 }
 
-func (intr *Interpreter) callFunction(parentScope *scope, fn parser.FnDef, parameters []runtimeVal) runtimeVal {
-	if len(parameters) != len(fn.Args) {
-		panic(fmt.Sprintf("expected %d arguments, got %d", len(fn.Args), len(parameters)))
+// equal compares two values of the same type
+func (intr *Interpreter) equal(left, right Value, e parser.BinaryExpression) bool {
+	if typeOf(left) != typeOf(right) {
+		intr.fail(TypeMismatch, e.Span(), "cannot compare %v with %v", typeOf(left), typeOf(right))
 	}
 
-	// Create a new scope for the function
-	fnScope := newScope(parentScope)
+	switch typeOf(left) {
+	case types.Int:
+		return intr.asInt(left, e.Left) == intr.asInt(right, e.Right)
+	case types.String:
+		return intr.asString(left, e.Left) == intr.asString(right, e.Right)
+	default:
+		return intr.asBool(left, e.Left) == intr.asBool(right, e.Right)
+	}
+}
 
-	// Add arguments to the scope
-	for i, arg := range fn.Args {
-		fnScope.DeclareVar(arg.Name, parameters[i])
+// compare orders two ints or two strings, returning a negative number if left is less than right,
+// zero if they are equal and a positive number if left is greater.
+func (intr *Interpreter) compare(left, right Value, e parser.BinaryExpression) int {
+	if _, ok := left.(stringVal); ok {
+		return strings.Compare(intr.asString(left, e.Left), intr.asString(right, e.Right))
 	}
+	return cmp.Compare(intr.asInt(left, e.Left), intr.asInt(right, e.Right))
+}
 
-	// Set the active scope to the function scope
-	intr.activeScope = fnScope
+// asInt returns the value of an int, failing with a type mismatch located at expr if val is something else.
+func (intr *Interpreter) asInt(val Value, expr parser.Expression) int64 {
+	n, ok := val.(numberVal)
+	if !ok {
+		intr.fail(TypeMismatch, expr.Span(), "expected %v, got %v", types.Int, typeOf(val))
+	}
+	return n.value
+}
 
-	// Evaluate the function body
-	for _, stmt := range fn.Body {
-		if retStmt, ok := stmt.(parser.Return); ok {
-			return intr.evaluateExpression(retStmt.Value)
+// asBool returns the value of a bool, failing with a type mismatch located at expr if val is something else.
+func (intr *Interpreter) asBool(val Value, expr parser.Expression) bool {
+	b, ok := val.(booleanVal)
+	if !ok {
+		intr.fail(TypeMismatch, expr.Span(), "expected %v, got %v", types.Bool, typeOf(val))
+	}
+	return b.value
+}
+
+// asString returns the value of a string, failing with a type mismatch located at expr if val is something else.
+func (intr *Interpreter) asString(val Value, expr parser.Expression) string {
+	s, ok := val.(stringVal)
+	if !ok {
+		intr.fail(TypeMismatch, expr.Span(), "expected %v, got %v", types.String, typeOf(val))
+	}
+	return s.value
+}
+
+// asFloat returns the value of a float, or an int promoted to float,
+// failing with a type mismatch located at expr if val is something else.
+func (intr *Interpreter) asFloat(val Value, expr parser.Expression) float64 {
+	switch v := val.(type) {
+	case floatVal:
+		return v.value
+	case numberVal:
+		return float64(v.value)
+	default:
+		intr.fail(TypeMismatch, expr.Span(), "expected %v, got %v", types.Float, typeOf(val))
+		return 0
+	}
+}
+
+// evaluateCall calls a function by name, or the function value of the callee.
+// Variables holding functions are looked up before functions, like in the parser.
+func (intr *Interpreter) evaluateCall(e parser.Call) Value {
+	var callee Value
+	if e.Callee != nil {
+		callee = intr.evaluateExpression(e.Callee)
+	}
+
+	var parameters []Value
+	for _, arg := range e.Args {
+		parameters = append(parameters, intr.evaluateExpression(arg))
+	}
+
+	if e.Callee == nil {
+		val, ok := intr.activeScope.GetVar(e.Name)
+		if !ok {
+			if fn, ok := intr.activeScope.GetFn(e.Name); ok {
+				return intr.callFunction(fn, parameters, e.Span())
+			}
+
+			if host, ok := intr.hostFuncs[e.Name]; ok {
+				return intr.callHost(host, parameters, e.Span())
+			}
+
+			intr.fail(UndefinedFunction, e.Span(), "function %s not defined", e.Name)
 		}
+		callee = val
+	}
 
-		intr.evaluateStatement(stmt)
+	f, ok := callee.(funcVal)
+	if !ok {
+		intr.fail(TypeMismatch, e.Span(), "cannot call %v", typeOf(callee))
 	}
 
-	// Reset the active scope to the parent scope
-	intr.activeScope = parentScope
+	if f.host != nil {
+		return intr.callHost(*f.host, parameters, e.Span())
+	}
 
-	return nil
+	return intr.callClosure(f.fn, f.env, parameters, e.Span())
+}
+
+// callFunction calls fn with the given parameters in a new frame and returns the value it returned.
+// The function body is evaluated in a scope under the global scope, not the scope of the caller.
+func (intr *Interpreter) callFunction(fn parser.FnDef, parameters []Value, callSite token.Span) Value {
+	return intr.callClosure(fn, intr.globalScope, parameters, callSite)
+}
+
+// callClosure works like callFunction, but evaluates the function body in a scope under env,
+// the scope that the function was created in.
+func (intr *Interpreter) callClosure(fn parser.FnDef, env *scope, parameters []Value, callSite token.Span) Value {
+	if len(parameters) != len(fn.Args) {
+		intr.fail(ArityMismatch, callSite, "%s expects %d arguments, got %d", fn.Name, len(fn.Args), len(parameters))
+	}
+
+	intr.enterCall(fn.Name, callSite)
+
+	f := &frame{
+		fn:          fn,
+		locals:      newScope(env),
+		callSite:    callSite,
+		callerScope: intr.activeScope,
+	}
+
+	// Add arguments to the scope
+	for i, arg := range fn.Args {
+		f.locals.DeclareVar(arg.Name, parameters[i])
+	}
+
+	intr.pushFrame(f)
+	intr.activeScope = f.locals
+
+	// Restore the caller even if the call is unwound by a panic
+	defer func() {
+		intr.popFrame()
+		intr.activeScope = f.callerScope
+	}()
+
+	intr.evaluateStatements(fn.Body)
+
+	return f.returnVal
 }
@@ -1,9 +1,16 @@
 package runtime
 
 import (
+	"context"
+	"errors"
+	"leoscript/diag"
 	"leoscript/lexer"
 	"leoscript/parser"
+	"leoscript/token"
+	"leoscript/types"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -15,7 +22,7 @@ func Test_ArithmeticExpr(t *testing.T) {
 		expr, _ := parser.NewParser(lx, nil).ParseExpr()
 
 		resp := i.evaluateExpression(expr)
-		assert.Equal(t, 123, resp.(numberVal).value)
+		assert.Equal(t, int64(123), resp.(numberVal).value)
 	})
 
 	t.Run("Single binary expression", func(t *testing.T) {
@@ -24,7 +31,7 @@ func Test_ArithmeticExpr(t *testing.T) {
 		expr, _ := parser.NewParser(lx, nil).ParseExpr()
 
 		resp := i.evaluateExpression(expr)
-		assert.Equal(t, 5, resp.(numberVal).value)
+		assert.Equal(t, int64(5), resp.(numberVal).value)
 	})
 
 	t.Run("Multiple binary expression", func(t *testing.T) {
@@ -33,7 +40,7 @@ func Test_ArithmeticExpr(t *testing.T) {
 		expr, _ := parser.NewParser(lx, nil).ParseExpr()
 
 		resp := i.evaluateExpression(expr)
-		assert.Equal(t, -9, resp.(numberVal).value)
+		assert.Equal(t, int64(-9), resp.(numberVal).value)
 	})
 
 	t.Run("Multiple binary expression with parentheses", func(t *testing.T) {
@@ -42,7 +49,7 @@ func Test_ArithmeticExpr(t *testing.T) {
 		expr, _ := parser.NewParser(lx, nil).ParseExpr()
 
 		resp := i.evaluateExpression(expr)
-		assert.Equal(t, 4, resp.(numberVal).value)
+		assert.Equal(t, int64(4), resp.(numberVal).value)
 	})
 
 	t.Run("Multiple binary expression with parentheses, order changed", func(t *testing.T) {
@@ -51,7 +58,25 @@ func Test_ArithmeticExpr(t *testing.T) {
 		expr, _ := parser.NewParser(lx, nil).ParseExpr()
 
 		resp := i.evaluateExpression(expr)
-		assert.Equal(t, -3, resp.(numberVal).value)
+		assert.Equal(t, int64(-3), resp.(numberVal).value)
+	})
+
+	t.Run("Integer literal forms", func(t *testing.T) {
+		i := New()
+		lx := lexer.MustTokenize("0x10 + 0o10 + 0b10 + 1_000;")
+		expr, _ := parser.NewParser(lx, nil).ParseExpr()
+
+		resp := i.evaluateExpression(expr)
+		assert.Equal(t, int64(1026), resp.(numberVal).value)
+	})
+
+	t.Run("Ints wrap around at 64 bits", func(t *testing.T) {
+		i := New()
+		lx := lexer.MustTokenize("0x7fff_ffff_ffff_ffff + 1;")
+		expr, _ := parser.NewParser(lx, nil).ParseExpr()
+
+		resp := i.evaluateExpression(expr)
+		assert.Equal(t, int64(-9223372036854775808), resp.(numberVal).value)
 	})
 }
 
@@ -100,6 +125,58 @@ func Test_BooleanExpr(t *testing.T) {
 		resp := i.evaluateExpression(expr)
 		assert.Equal(t, true, resp.(booleanVal).value)
 	})
+
+	t.Run("Right operand guarded by the left one", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn firstZero([]int a) int {
+				var i = 0;
+				while (i < len(a) && a[i] != 0) {
+					i++;
+				}
+				if (i == len(a) || a[i] == 0) {
+					return i;
+				}
+				return -1;
+			}
+
+			fn main() []int {
+				return [firstZero([1, 0]), firstZero([1, 2])];
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []any{int64(1), int64(2)}, ToNative(resp))
+	})
+
+	t.Run("Right operand is not evaluated when the left one decides", func(t *testing.T) {
+		i := New()
+
+		var calls []bool
+		err := i.RegisterHostFunc("check", Signature{Args: []types.Type{types.Bool}, ReturnType: types.Bool}, func(args []Value) (Value, error) {
+			b, _ := args[0].AsBool()
+			calls = append(calls, b)
+			return args[0], nil
+		})
+		assert.NoError(t, err)
+
+		err = i.LoadRaw(`
+			fn main() bool {
+				var a = false && check(true);
+				var b = true || check(true);
+				return a || b && check(false);
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, false, resp.(booleanVal).value)
+		assert.Equal(t, []bool{false}, calls)
+	})
 }
 
 func Test_Arithmetic_UnaryExpr(t *testing.T) {
@@ -109,7 +186,7 @@ func Test_Arithmetic_UnaryExpr(t *testing.T) {
 		expr, _ := parser.NewParser(lx, nil).ParseExpr()
 
 		resp := i.evaluateExpression(expr)
-		assert.Equal(t, -1, resp.(numberVal).value)
+		assert.Equal(t, int64(-1), resp.(numberVal).value)
 	})
 
 	t.Run("Multiple unary expression", func(t *testing.T) {
@@ -118,7 +195,7 @@ func Test_Arithmetic_UnaryExpr(t *testing.T) {
 		expr, _ := parser.NewParser(lx, nil).ParseExpr()
 
 		resp := i.evaluateExpression(expr)
-		assert.Equal(t, 1, resp.(numberVal).value)
+		assert.Equal(t, int64(1), resp.(numberVal).value)
 	})
 
 	t.Run("Multiple unary expression with parentheses", func(t *testing.T) {
@@ -127,7 +204,24 @@ func Test_Arithmetic_UnaryExpr(t *testing.T) {
 		expr, _ := parser.NewParser(lx, nil).ParseExpr()
 
 		resp := i.evaluateExpression(expr)
-		assert.Equal(t, 1, resp.(numberVal).value)
+		assert.Equal(t, int64(1), resp.(numberVal).value)
+	})
+
+	t.Run("Double signs are not increments in expressions", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn main() int {
+				var x = 5;
+				x--;
+				return --x * 10 + ++x;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(44), resp.(numberVal).value)
 	})
 }
 
@@ -197,6 +291,166 @@ func Test_Boolean_Comparisons(t *testing.T) {
 	})
 }
 
+func Test_Floats(t *testing.T) {
+	t.Run("Float arithmetic", func(t *testing.T) {
+		i := New()
+		lx := lexer.MustTokenize("1.5 * 2.0 - .25;")
+		expr, _ := parser.NewParser(lx, nil).ParseExpr()
+
+		resp := i.evaluateExpression(expr)
+		assert.Equal(t, 2.75, resp.(floatVal).value)
+	})
+
+	t.Run("Ints are promoted", func(t *testing.T) {
+		i := New()
+		lx := lexer.MustTokenize("-(7 / 2) + 7 / 2.0;")
+		expr, _ := parser.NewParser(lx, nil).ParseExpr()
+
+		resp := i.evaluateExpression(expr)
+		assert.Equal(t, 0.5, resp.(floatVal).value)
+	})
+
+	t.Run("Comparisons", func(t *testing.T) {
+		i := New()
+		lx := lexer.MustTokenize("1.5 > 1 && 2 <= 2.0 && 1e2 == 100 && 0.1 != 0.2;")
+		expr, _ := parser.NewParser(lx, nil).ParseExpr()
+
+		resp := i.evaluateExpression(expr)
+		assert.Equal(t, true, resp.(booleanVal).value)
+	})
+
+	t.Run("Pricing rule", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn price(int quantity, float unitPrice) float {
+				var total = quantity * unitPrice;
+				if (quantity >= 10) {
+					return total * 0.9;
+				}
+				return total;
+			}
+
+			fn main() float {
+				return price(10, 2.5);
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 22.5, resp.(floatVal).value)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn div() float {
+				return 1.5 / 0;
+			}
+		`)
+		assert.NoError(t, err)
+
+		_, err = i.Call(context.Background(), "div")
+		assert.True(t, IsKind(err, DivisionByZero))
+
+		// Comparing mismatched types is caught before the program runs
+		err = i.LoadRaw(`
+			fn cmp() bool {
+				return 1.5 == true;
+			}
+		`)
+		assert.ErrorContains(t, err, "3:12: operator == cannot be used with float and bool")
+	})
+}
+
+func Test_NumberConversions(t *testing.T) {
+	i := New()
+
+	err := i.LoadRaw(`
+		fn half(float x) float {
+			return x / 2;
+		}
+
+		fn whole() float {
+			return 2;
+		}
+
+		fn main() []float {
+			float f = 1;
+			var n = 7;
+			return [f, half(n), whole(), float(int(-2.75)), float(n / 2)];
+		}
+	`)
+	assert.NoError(t, err)
+
+	resp, err := i.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []any{1.0, 3.5, 2.0, -2.0, 3.0}, ToNative(resp))
+}
+
+func Test_Strings(t *testing.T) {
+	t.Run("Concatenation", func(t *testing.T) {
+		i := New()
+		lx := lexer.MustTokenize(`"foo" + "\t" + "bar";`)
+		expr, _ := parser.NewParser(lx, nil).ParseExpr()
+
+		resp := i.evaluateExpression(expr)
+		assert.Equal(t, "foo\tbar", resp.(stringVal).value)
+	})
+
+	t.Run("Comparison", func(t *testing.T) {
+		i := New()
+		lx := lexer.MustTokenize(`"a" + "b" == "ab" && "ab" != "b" && "abc" < "abd" && "b" > "abc";`)
+		expr, _ := parser.NewParser(lx, nil).ParseExpr()
+
+		resp := i.evaluateExpression(expr)
+		assert.Equal(t, true, resp.(booleanVal).value)
+	})
+
+	t.Run("Build a message", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn greet(string name, bool loud) string {
+				var msg = "hello, " + name;
+				if (loud) {
+					return msg + "!";
+				}
+				return msg;
+			}
+
+			fn main() string {
+				return greet("world", true);
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "hello, world!", resp.(stringVal).value)
+	})
+
+	t.Run("Mixing strings and ints", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn main() string {
+				return "n=" + 1;
+			}
+		`)
+		assert.ErrorContains(t, err, "3:12: operator + cannot be used with string and int")
+
+		err = i.LoadRaw(`
+			fn f() bool {
+				return "a" == 1;
+			}
+		`)
+		assert.ErrorContains(t, err, "3:12: operator == cannot be used with string and int")
+	})
+}
+
 func Test_VariableDeclarations(t *testing.T) {
 	t.Run("Variable declaration", func(t *testing.T) {
 		i := New()
@@ -208,7 +462,7 @@ func Test_VariableDeclarations(t *testing.T) {
 		// Check if variable is declared
 		val, ok := i.activeScope.GetVar("foo")
 		assert.True(t, ok)
-		assert.Equal(t, 123, val.(numberVal).value)
+		assert.Equal(t, int64(123), val.(numberVal).value)
 	})
 
 	t.Run("Variable declaration with expression", func(t *testing.T) {
@@ -220,7 +474,7 @@ func Test_VariableDeclarations(t *testing.T) {
 
 		val, ok := i.activeScope.GetVar("foo")
 		assert.True(t, ok)
-		assert.Equal(t, 7, val.(numberVal).value)
+		assert.Equal(t, int64(7), val.(numberVal).value)
 	})
 
 	t.Run("Variable declaration with boolean expression", func(t *testing.T) {
@@ -254,7 +508,7 @@ func Test_Identifiers(t *testing.T) {
 
 		val, ok := i.activeScope.GetVar("bar")
 		assert.True(t, ok)
-		assert.Equal(t, 123, val.(numberVal).value)
+		assert.Equal(t, int64(123), val.(numberVal).value)
 	})
 
 	t.Run("Variable declaration with identifier and expression", func(t *testing.T) {
@@ -274,11 +528,71 @@ func Test_Identifiers(t *testing.T) {
 
 		val, ok := i.activeScope.GetVar("bar")
 		assert.True(t, ok)
-		assert.Equal(t, 124, val.(numberVal).value)
+		assert.Equal(t, int64(124), val.(numberVal).value)
 	})
 }
 
 func Test_RunCompleteFile(t *testing.T) {
+	t.Run("Load from a reader", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadReader("main.leo", iotest.OneByteReader(strings.NewReader(`
+			fn main() int {
+				return 41 + 1;
+			}
+		`)))
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(42), resp.(numberVal).value)
+
+		err = i.LoadReader("broken.leo", strings.NewReader("fn f() int { return 1 $ 2; }"))
+		assert.ErrorContains(t, err, "broken.leo:1:23: invalid character: $\nbroken.leo:1:25: unexpected token in expression")
+
+		readErr := errors.New("connection reset")
+		err = i.LoadReader("stdin", iotest.ErrReader(readErr))
+		assert.ErrorIs(t, err, readErr)
+		assert.EqualError(t, err, "reading stdin: connection reset")
+	})
+
+	t.Run("Syntax and type errors are reported together", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`fn main() int {
+	int a = true;
+	var b = c + 1;
+	var d = 2;
+	return d +;
+}
+
+var e = ;
+
+fn foo( {}
+`)
+		var diags diag.Diagnostics
+		assert.ErrorAs(t, err, &diags)
+
+		var codes []diag.Code
+		var lines []int
+		for _, d := range diags {
+			codes = append(codes, d.Code)
+			lines = append(lines, d.Span.Start.Line)
+		}
+
+		assert.Equal(t, []diag.Code{diag.CodeTypeMismatch, diag.CodeUndeclared, diag.CodeSyntax, diag.CodeSyntax, diag.CodeSyntax}, codes)
+		assert.Equal(t, []int{2, 3, 5, 8, 10}, lines)
+	})
+
+	t.Run("Invalid literals are only reported once", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`fn main() int {
+	return 99999999999999999999;
+}`)
+		assert.EqualError(t, err, "2:9: integer literal out of range: 99999999999999999999")
+	})
+
 	t.Run("Simple main function", func(t *testing.T) {
 		i := New()
 
@@ -289,9 +603,9 @@ func Test_RunCompleteFile(t *testing.T) {
 		`)
 		assert.NoError(t, err)
 
-		resp, err := i.Run()
+		resp, err := i.Run(context.Background())
 		assert.NoError(t, err)
-		assert.Equal(t, 1, resp.(numberVal).value)
+		assert.Equal(t, int64(1), resp.(numberVal).value)
 	})
 
 	t.Run("Functioncall", func(t *testing.T) {
@@ -308,9 +622,9 @@ func Test_RunCompleteFile(t *testing.T) {
 		`)
 		assert.NoError(t, err)
 
-		resp, err := i.Run()
+		resp, err := i.Run(context.Background())
 		assert.NoError(t, err)
-		assert.Equal(t, 4, resp.(numberVal).value)
+		assert.Equal(t, int64(4), resp.(numberVal).value)
 	})
 
 	t.Run("variable declaration", func(t *testing.T) {
@@ -324,9 +638,9 @@ func Test_RunCompleteFile(t *testing.T) {
 		`)
 		assert.NoError(t, err)
 
-		resp, err := i.Run()
+		resp, err := i.Run(context.Background())
 		assert.NoError(t, err)
-		assert.Equal(t, 11, resp.(numberVal).value)
+		assert.Equal(t, int64(11), resp.(numberVal).value)
 	})
 
 	t.Run("global and local scope", func(t *testing.T) {
@@ -335,16 +649,49 @@ func Test_RunCompleteFile(t *testing.T) {
 		err := i.LoadRaw(`
 			var a = 10;
 
-			fn main() {
+			fn main() int {
 				var b = 11;
 				return a + b;
 			}
 		`)
 		assert.NoError(t, err)
 
-		resp, err := i.Run()
+		resp, err := i.Run(context.Background())
 		assert.NoError(t, err)
-		assert.Equal(t, 21, resp.(numberVal).value)
+		assert.Equal(t, int64(21), resp.(numberVal).value)
+	})
+
+	t.Run("globals are initialized in source order and shared by functions", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			var base = 10;
+			var count = base + start();
+
+			fn start() int {
+				return base * 2;
+			}
+
+			fn bump() {
+				count = count + 1;
+			}
+
+			fn main() int {
+				bump();
+				bump();
+				return count;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(32), resp.(numberVal).value)
+
+		// The globals keep their values between calls
+		resp, err = i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(34), resp.(numberVal).value)
 	})
 
 	t.Run("local overrides global scope", func(t *testing.T) {
@@ -353,15 +700,669 @@ func Test_RunCompleteFile(t *testing.T) {
 		err := i.LoadRaw(`
 			var a = 10;
 
-			fn main() {
+			fn main() int {
 				var a = 11;
 				return a;
 			}
 		`)
 		assert.NoError(t, err)
 
-		resp, err := i.Run()
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(11), resp.(numberVal).value)
+	})
+}
+
+func Test_Assignments(t *testing.T) {
+	t.Run("Reassignment", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn main() string {
+				var s = "a";
+				if (true) {
+					s = s + "b";
+				}
+				return s;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "ab", resp.(stringVal).value)
+	})
+
+	t.Run("Compound assignments", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn main() int {
+				int n = 10;
+				n += 5;
+				n -= 3;
+				n *= 2 + 1;
+				n /= 4;
+				n++;
+				n++;
+				n--;
+				return n;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(10), resp.(numberVal).value)
+	})
+
+	t.Run("Increment in a loop", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn main() float {
+				float total = 0.5;
+				for (var i = 0; i < 4; i++) {
+					total += i;
+				}
+				return total;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
 		assert.NoError(t, err)
-		assert.Equal(t, 11, resp.(numberVal).value)
+		assert.Equal(t, 6.5, resp.(floatVal).value)
+	})
+}
+
+func Test_Constants(t *testing.T) {
+	i := New()
+
+	err := i.LoadRaw(`
+		const int rows = 4;
+		const cells = rows * rows;
+		const name = "grid";
+
+		fn main() string {
+			const half = cells / 2;
+			return name + " of " + label(half);
+		}
+
+		fn label(int n) string {
+			if (n == 8) {
+				return "eight";
+			}
+			return "other";
+		}
+	`)
+	assert.NoError(t, err)
+
+	resp, err := i.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "grid of eight", resp.(stringVal).value)
+}
+
+func Test_Blocks(t *testing.T) {
+	i := New()
+
+	err := i.LoadRaw(`
+		fn main() int {
+			var a = 1;
+			var sum = 0;
+			{
+				var a = 10;
+				sum += a;
+				{
+					a += 5;
+					sum += a;
+				}
+			}
+			{
+				var b = 100;
+				sum += b + a;
+			}
+			return sum;
+		}
+	`)
+	assert.NoError(t, err)
+
+	resp, err := i.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(126), resp.(numberVal).value)
+	assert.Same(t, i.globalScope, i.activeScope)
+
+	// Shadowing a is only warned about
+	warnings := i.Warnings()
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, diag.CodeShadowed, warnings[0].Code)
+	assert.Equal(t, 6, warnings[0].Span.Start.Line)
+}
+
+func Test_Closures(t *testing.T) {
+	i := New()
+
+	err := i.LoadRaw(`
+		fn(int) int double = fn(int n) int { return n * 2; };
+
+		fn counter() fn() int {
+			var count = 0;
+			return fn() int {
+				count++;
+				return count;
+			};
+		}
+
+		fn adder(int a) fn(int) int {
+			return fn(int b) int { return a + b; };
+		}
+
+		fn apply(fn(int) int f, int v) int {
+			return f(v);
+		}
+
+		fn square(int n) int {
+			return n * n;
+		}
+
+		fn main() int {
+			var next = counter();
+			next();
+			next();
+			var other = counter();
+			other();
+
+			return next() * 1000 + other() * 100 + apply(square, 3) + apply(double, 2) + adder(1)(2);
+		}
+	`)
+	assert.NoError(t, err)
+
+	resp, err := i.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3216), resp.(numberVal).value)
+}
+
+func Test_Lists(t *testing.T) {
+	t.Run("Literals, indexes and builtins", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			[]int primes = [2, 3, 5, 7];
+
+			fn sum([]int list) int {
+				var total = 0;
+				for (var n in list) {
+					total += n;
+				}
+				return total;
+			}
+
+			fn squares(int n) []int {
+				[]int result = [];
+				for (var i = 0; i < n; i++) {
+					result = append(result, i * i);
+				}
+				return result;
+			}
+
+			fn main() []int {
+				var grid = [[1, 2], [3, 4]];
+				grid[1][0] = 30;
+				primes[0] += 10;
+
+				// Slices share the elements of the list
+				var middle = primes[1:3];
+				middle[0] = 33;
+
+				return [sum(squares(4)), sum(primes), grid[1][0], len(primes[2:]), primes[1]];
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []any{int64(14), int64(57), int64(30), int64(2), int64(33)}, ToNative(resp))
+	})
+
+	t.Run("Compound assignments evaluate the list and the index once", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			var calls = 0;
+
+			fn next() int {
+				calls++;
+				return calls - 1;
+			}
+
+			fn main() []int {
+				var list = [1, 2, 3];
+				list[next()] += 10;
+				list[next()]++;
+				return [list[0], list[1], list[2], calls];
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []any{int64(11), int64(3), int64(3), int64(2)}, ToNative(resp))
+	})
+
+	t.Run("Appending to a slice does not overwrite the list", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn main() []int {
+				var list = [1, 2, 3];
+				var head = append(list[:1], 10);
+				head[0] = 0;
+				return list;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []any{int64(1), int64(2), int64(3)}, ToNative(resp))
+		assert.Equal(t, "[1, 2, 3]", resp.String())
+	})
+
+	t.Run("Break and continue", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn main() int {
+				var found = 0;
+				for (var n in [1, -2, 3, 4, 5]) {
+					if (n < 0) {
+						continue;
+					}
+					if (n > 3) {
+						break;
+					}
+					found += n;
+				}
+				return found;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), resp.(numberVal).value)
+	})
+
+	t.Run("Closures keep the element of their iteration", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn main() int {
+				[]fn() int getters = [];
+				for (var n in [1, 2, 3]) {
+					getters = append(getters, fn() int { return n; });
+				}
+				return getters[0]() * 100 + getters[1]() * 10 + getters[2]();
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(123), resp.(numberVal).value)
+	})
+
+	t.Run("Index out of range", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadFile("main.leo", `fn main() int {
+	var list = [1, 2, 3];
+	return list[len(list)];
+}
+
+fn slice() []int {
+	var list = [1, 2, 3];
+	return list[2:1];
+}`)
+		assert.NoError(t, err)
+
+		_, err = i.Run(context.Background())
+		assert.True(t, IsKind(err, IndexOutOfRange))
+		assert.EqualError(t, err, "main.leo:3:14: index 3 out of range for list of length 3")
+
+		_, err = i.Call(context.Background(), "slice")
+		assert.True(t, IsKind(err, IndexOutOfRange))
+		assert.EqualError(t, err, "main.leo:8:9: slice bounds 2:1 out of range for list of length 3")
+	})
+}
+
+func Test_CallbackShadowsFunction(t *testing.T) {
+	i := New()
+
+	err := i.LoadRaw(`
+		fn f(int x) int {
+			return x + 1000;
+		}
+
+		fn apply(fn(int) int f, int x) int {
+			return f(x);
+		}
+
+		fn main() int {
+			var double = fn(int n) int { return n * 2; };
+			return apply(double, 5) + f(0);
+		}
+	`)
+	assert.NoError(t, err)
+
+	resp, err := i.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1010), resp.(numberVal).value)
+}
+
+func Test_ErrorPositions(t *testing.T) {
+	t.Run("Parse error", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadFile("main.leo", `fn main() int {
+	return 1 + b;
+}`)
+		assert.ErrorContains(t, err, "main.leo:2:13: undeclared variable: b")
+	})
+
+	t.Run("Runtime error", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadFile("main.leo", `fn main() int {
+	return 1 / 0;
+}`)
+		assert.NoError(t, err)
+
+		_, err = i.Run(context.Background())
+		assert.ErrorContains(t, err, "main.leo:2:9: division by zero")
+	})
+}
+
+func Test_If(t *testing.T) {
+	t.Run("Return from branches", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn sign(int x) int {
+				if (x < 0) {
+					return -1;
+				} else if (x == 0) {
+					return 0;
+				} else {
+					return 1;
+				}
+			}
+
+			fn main() int {
+				return sign(-5) + sign(0) * 10 + sign(7) * 100;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(99), resp.(numberVal).value)
+	})
+
+	t.Run("Execution continues after the if", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn main() int {
+				var a = 1;
+				if (a == 2) {
+					return 100;
+				}
+				return a;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), resp.(numberVal).value)
+	})
+}
+
+func Test_Loops(t *testing.T) {
+	t.Run("While loop", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn main() int {
+				var n = 0;
+				var sum = 0;
+				while (n < 5) {
+					n = n + 1;
+					sum = sum + n;
+				}
+				return sum;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(15), resp.(numberVal).value)
+	})
+
+	t.Run("For loop with break and continue", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn main() int {
+				var sum = 0;
+				for (var i = 0; i < 100; i = i + 1) {
+					if (i == 3) {
+						continue;
+					}
+					if (i == 6) {
+						break;
+					}
+					sum = sum + i;
+				}
+				return sum;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0+1+2+4+5), resp.(numberVal).value)
+	})
+
+	t.Run("Return from inside nested loops", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn main() int {
+				for (;;) {
+					var a = 0;
+					while (true) {
+						a = a + 1;
+						if (a == 7) {
+							return a;
+						}
+					}
+				}
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), resp.(numberVal).value)
+	})
+}
+
+func Test_CallFrames(t *testing.T) {
+	t.Run("Recursion", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn fib(int n) int {
+				if (n < 2) {
+					return n;
+				}
+				return fib(n - 1) + fib(n - 2);
+			}
+
+			fn main() int {
+				return fib(15);
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(610), resp.(numberVal).value)
+		assert.Empty(t, i.frames)
+		assert.Same(t, i.globalScope, i.activeScope)
+	})
+
+	t.Run("Caller scope is restored after an early return", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn find(int limit) int {
+				for (var x = 0; x < 100; x = x + 1) {
+					if (x * x > limit) {
+						return x;
+					}
+				}
+				return -1;
+			}
+
+			fn main() int {
+				var a = 1;
+				var b = find(50);
+				return a * 100 + b;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(108), resp.(numberVal).value)
+	})
+
+	t.Run("Callee does not see the locals of the caller", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			var a = 1;
+
+			fn getA() int {
+				return a;
+			}
+
+			fn main() int {
+				var a = 2;
+				return getA();
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), resp.(numberVal).value)
+	})
+}
+
+// bogusStatement is a statement the interpreter does not know how to execute
+type bogusStatement struct{}
+
+func (bogusStatement) Span() token.Span { return token.Span{} }
+
+func Test_RuntimeErrors(t *testing.T) {
+	t.Run("Division by zero with stack trace", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadFile("main.leo", `fn div(int a, int b) int {
+	return a / b;
+}
+
+fn main() int {
+	return div(1, 0);
+}`)
+		assert.NoError(t, err)
+
+		_, err = i.Run(context.Background())
+
+		var rtErr *Error
+		assert.ErrorAs(t, err, &rtErr)
+		assert.Equal(t, DivisionByZero, rtErr.Kind)
+		assert.True(t, IsKind(err, DivisionByZero))
+		assert.EqualError(t, err, "main.leo:2:9: division by zero")
+		assert.Equal(t, `main.leo:2:9: division by zero
+	at div (main.leo:2:9)
+	at main (main.leo:6:9)`, rtErr.StackTrace())
+
+		assert.Empty(t, i.frames)
+		assert.Same(t, i.globalScope, i.activeScope)
+	})
+
+	t.Run("Type mismatch", func(t *testing.T) {
+		i := New()
+
+		// LoadRaw rejects the program with the type checker, so evaluate it unchecked
+		prog, err := parser.NewParser(lexer.MustTokenize(`
+			fn main() int {
+				return 1 + true;
+			}
+		`), nil).ParseFile()
+		assert.NoError(t, err)
+		assert.NoError(t, i.evaluateProgram(context.Background(), prog))
+
+		_, err = i.Run(context.Background())
+		assert.True(t, IsKind(err, TypeMismatch))
+		assert.ErrorContains(t, err, "3:16: expected int, got bool")
+	})
+
+	t.Run("Arity mismatch", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			fn foo() int {
+				return 1;
+			}
+
+			fn main() {}
+		`)
+		assert.NoError(t, err)
+
+		// The type checker rejects calls with the wrong number of arguments, so call it directly
+		fn, _ := i.globalScope.GetFn("foo")
+		err = func() (err error) {
+			defer i.recoverError(&err, 0, i.globalScope)
+			i.callFunction(fn, []Value{Int(1)}, token.Span{})
+			return nil
+		}()
+		assert.True(t, IsKind(err, ArityMismatch))
+		assert.ErrorContains(t, err, "foo expects 0 arguments, got 1")
+	})
+
+	t.Run("Error while loading", func(t *testing.T) {
+		i := New()
+
+		err := i.LoadRaw(`
+			var a = 1 / 0;
+
+			fn main() {}
+		`)
+		assert.True(t, IsKind(err, DivisionByZero))
+	})
+
+	t.Run("Interpreter bugs are internal errors", func(t *testing.T) {
+		i := New()
+
+		err := i.evaluateProgram(context.Background(), parser.Program{Body: []parser.Statement{bogusStatement{}}})
+		assert.True(t, IsKind(err, Internal))
+		assert.ErrorContains(t, err, "internal error: unknown statement")
 	})
 }
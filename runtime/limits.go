@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"leoscript/token"
+)
+
+// Limits caps the resources that a single Run or Call may use. A zero value means no limit.
+type Limits struct {
+	// MaxSteps is the number of statements and loop iterations that may be executed.
+	MaxSteps int
+	// MaxCallDepth is the number of nested function calls.
+	MaxCallDepth int
+	// MaxAllocations is the number of values that may be created while evaluating expressions.
+	// The bytes of the strings built by concatenation and the elements added to lists count as well,
+	// so that the limit bounds the memory used.
+	MaxAllocations int
+}
+
+// DefaultLimits only caps the call depth, so that runaway recursion does not overflow the Go stack.
+var DefaultLimits = Limits{
+	MaxCallDepth: 10_000,
+}
+
+// SetLimits replaces the limits used by subsequent calls into the interpreter.
+func (intr *Interpreter) SetLimits(limits Limits) {
+	intr.limits = limits
+}
+
+// execution tracks the resources used by the current Run or Call.
+type execution struct {
+	ctx    context.Context
+	done   <-chan struct{}
+	steps  int
+	allocs int
+}
+
+func (intr *Interpreter) startExecution(ctx context.Context) {
+	intr.exec = execution{ctx: ctx, done: ctx.Done()}
+}
+
+// nestExecution continues the current execution for a call made by a host function while it runs.
+// The call uses the remaining budget of the execution, and is cancelled by its own context as well as
+// by the context of the execution. The returned function restores the context of the execution.
+func (intr *Interpreter) nestExecution(ctx context.Context) (restore func()) {
+	outer := intr.exec
+
+	merged, cancel := context.WithCancelCause(outer.ctx)
+	stop := context.AfterFunc(ctx, func() { cancel(context.Cause(ctx)) })
+	intr.exec.ctx, intr.exec.done = merged, merged.Done()
+
+	return func() {
+		stop()
+		cancel(nil)
+		intr.exec.ctx, intr.exec.done = outer.ctx, outer.done
+	}
+}
+
+// step is called before every statement and after every loop iteration.
+// It aborts the execution if the context has been cancelled or the step limit is reached.
+func (intr *Interpreter) step(span token.Span) {
+	select {
+	case <-intr.exec.done:
+		intr.failCancelled(span.Start)
+	default:
+	}
+
+	intr.exec.steps++
+	if intr.limits.MaxSteps > 0 && intr.exec.steps > intr.limits.MaxSteps {
+		intr.fail(StepLimitExceeded, span, "step limit of %d exceeded", intr.limits.MaxSteps)
+	}
+}
+
+// alloc is called for every value created while evaluating an expression.
+func (intr *Interpreter) alloc(span token.Span) {
+	intr.allocData(span, 1)
+}
+
+// allocData is called before creating size bytes of a string or elements of a list,
+// so that the limit is exceeded before the memory is used.
+func (intr *Interpreter) allocData(span token.Span, size int) {
+	intr.exec.allocs += size
+	if intr.limits.MaxAllocations > 0 && intr.exec.allocs > intr.limits.MaxAllocations {
+		intr.fail(AllocationLimitExceeded, span, "allocation limit of %d exceeded", intr.limits.MaxAllocations)
+	}
+}
+
+// enterCall is called before every function call and enforces the call depth limit.
+func (intr *Interpreter) enterCall(fnName string, callSite token.Span) {
+	if intr.limits.MaxCallDepth > 0 && len(intr.frames) >= intr.limits.MaxCallDepth {
+		intr.fail(CallDepthExceeded, callSite, "call depth limit of %d exceeded calling %s", intr.limits.MaxCallDepth, fnName)
+	}
+}
+
+func (intr *Interpreter) failCancelled(pos token.Position) {
+	// The cause is the error of the context that was cancelled, also for nested executions
+	err := context.Cause(intr.exec.ctx)
+
+	rtErr := intr.newError(Cancelled, pos, fmt.Sprintf("execution cancelled: %v", err))
+	rtErr.Err = err
+	panic(rtErr)
+}
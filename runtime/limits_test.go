@@ -0,0 +1,242 @@
+package runtime_test
+
+import (
+	"context"
+	"leoscript/runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Limits(t *testing.T) {
+	load := func(t *testing.T, limits runtime.Limits, src string) *runtime.Interpreter {
+		i := runtime.New()
+		i.SetLimits(limits)
+		assert.NoError(t, i.LoadRaw(src))
+		return i
+	}
+
+	t.Run("Cancel an infinite loop", func(t *testing.T) {
+		i := load(t, runtime.Limits{}, `
+			fn main() {
+				while (true) {}
+			}
+		`)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := i.Run(ctx)
+		assert.True(t, runtime.IsKind(err, runtime.Cancelled))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Cancelled between statements", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		i := runtime.New()
+		assert.NoError(t, i.RegisterHostFunc("cancel", runtime.Signature{}, func([]runtime.Value) (runtime.Value, error) {
+			cancel()
+			return nil, nil
+		}))
+		assert.NoError(t, i.LoadRaw(`
+			fn main() int {
+				cancel();
+				return 1;
+			}
+		`))
+
+		_, err := i.Run(ctx)
+		assert.True(t, runtime.IsKind(err, runtime.Cancelled))
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.EqualError(t, err, "4:5: execution cancelled: context canceled")
+	})
+
+	t.Run("Cancel a runaway variable initializer", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		i := runtime.New()
+		err := i.Load(ctx, "rules.leo", strings.NewReader(`
+			fn spin() int {
+				while (true) {}
+				return 0;
+			}
+
+			int x = spin();
+		`))
+		assert.True(t, runtime.IsKind(err, runtime.Cancelled))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// The step limit applies as well
+		i = runtime.New()
+		i.SetLimits(runtime.Limits{MaxSteps: 100})
+		err = i.Load(context.Background(), "rules.leo", strings.NewReader(`
+			fn spin() int {
+				while (true) {}
+				return 0;
+			}
+
+			int x = spin();
+		`))
+		assert.EqualError(t, err, "rules.leo:3:5: step limit of 100 exceeded")
+	})
+
+	t.Run("Step limit", func(t *testing.T) {
+		i := load(t, runtime.Limits{MaxSteps: 100}, `
+			fn main() {
+				while (true) {}
+			}
+		`)
+
+		_, err := i.Run(context.Background())
+		assert.True(t, runtime.IsKind(err, runtime.StepLimitExceeded))
+		assert.EqualError(t, err, "3:5: step limit of 100 exceeded")
+	})
+
+	t.Run("Steps are counted per call", func(t *testing.T) {
+		i := load(t, runtime.Limits{MaxSteps: 3}, `
+			fn f() int {
+				var a = 1;
+				return a;
+			}
+		`)
+
+		for range 5 {
+			resp, err := i.Call(context.Background(), "f")
+			assert.NoError(t, err)
+			assert.Equal(t, runtime.Int(1), resp)
+		}
+	})
+
+	t.Run("Calls from host functions share the budget", func(t *testing.T) {
+		i := runtime.New()
+		i.SetLimits(runtime.Limits{MaxSteps: 100})
+
+		calls := 0
+		assert.NoError(t, i.RegisterHostFunc("cb", runtime.Signature{}, func([]runtime.Value) (runtime.Value, error) {
+			calls++
+			_, err := i.Call(context.Background(), "tick")
+			return nil, err
+		}))
+		assert.NoError(t, i.LoadRaw(`
+			fn tick() {
+				var a = 1;
+			}
+
+			fn main() {
+				while (true) {
+					cb();
+				}
+			}
+		`))
+
+		// Each iteration takes two steps of the loop and one of the callback
+		_, err := i.Run(context.Background())
+		assert.ErrorContains(t, err, "step limit of 100 exceeded")
+		assert.Equal(t, 33, calls)
+	})
+
+	t.Run("Calls from host functions are cancelled with the outer execution", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		i := runtime.New()
+		assert.NoError(t, i.RegisterHostFunc("cb", runtime.Signature{}, func([]runtime.Value) (runtime.Value, error) {
+			// The context of the callback itself is not cancelled
+			cancel()
+			_, err := i.Call(context.Background(), "tick")
+			return nil, err
+		}))
+		assert.NoError(t, i.LoadRaw(`
+			fn tick() {
+				while (true) {}
+			}
+
+			fn main() {
+				cb();
+			}
+		`))
+
+		_, err := i.Run(ctx)
+		assert.True(t, runtime.IsKind(err, runtime.HostError))
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Call depth limit", func(t *testing.T) {
+		i := load(t, runtime.Limits{MaxCallDepth: 50}, `
+			fn f(int n) int {
+				return f(n + 1);
+			}
+		`)
+
+		_, err := i.Call(context.Background(), "f", runtime.Int(0))
+		assert.True(t, runtime.IsKind(err, runtime.CallDepthExceeded))
+		assert.EqualError(t, err, "3:12: call depth limit of 50 exceeded calling f")
+
+		var rtErr *runtime.Error
+		assert.ErrorAs(t, err, &rtErr)
+		assert.Len(t, rtErr.Stack, 50)
+	})
+
+	t.Run("Default limits stop runaway recursion", func(t *testing.T) {
+		i := load(t, runtime.DefaultLimits, `
+			fn main() int {
+				return main();
+			}
+		`)
+
+		_, err := i.Run(context.Background())
+		assert.True(t, runtime.IsKind(err, runtime.CallDepthExceeded))
+	})
+
+	t.Run("Allocation limit", func(t *testing.T) {
+		i := load(t, runtime.Limits{MaxAllocations: 10}, `
+			fn main() int {
+				var a = 0;
+				while (true) {
+					a = a + 1;
+				}
+				return a;
+			}
+		`)
+
+		_, err := i.Run(context.Background())
+		assert.True(t, runtime.IsKind(err, runtime.AllocationLimitExceeded))
+		assert.EqualError(t, err, "4:12: allocation limit of 10 exceeded")
+	})
+
+	t.Run("Allocations count the size of strings", func(t *testing.T) {
+		i := load(t, runtime.Limits{MaxAllocations: 1_000_000}, `
+			fn main() string {
+				var s = "ab";
+				for (var n = 0; n < 40; n++) {
+					s = s + s;
+				}
+				return s;
+			}
+		`)
+
+		_, err := i.Run(context.Background())
+		assert.True(t, runtime.IsKind(err, runtime.AllocationLimitExceeded))
+		assert.EqualError(t, err, "5:10: allocation limit of 1000000 exceeded")
+	})
+
+	t.Run("Allocations count the elements of lists", func(t *testing.T) {
+		i := load(t, runtime.Limits{MaxAllocations: 100}, `
+			fn main() []int {
+				var list = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10];
+				for (var n = 0; n < 5; n++) {
+					list = append(list, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10);
+				}
+				return list;
+			}
+		`)
+
+		_, err := i.Run(context.Background())
+		assert.True(t, runtime.IsKind(err, runtime.AllocationLimitExceeded))
+	})
+}
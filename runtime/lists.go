@@ -0,0 +1,135 @@
+package runtime
+
+import (
+	"leoscript/parser"
+	"leoscript/types"
+)
+
+func (intr *Interpreter) evaluateListLiteral(e parser.ListLiteral) Value {
+	items := make([]Value, 0, len(e.Elems))
+	for _, elem := range e.Elems {
+		items = append(items, intr.evaluateExpression(elem))
+	}
+	intr.alloc(e.Span())
+	intr.allocData(e.Span(), len(items))
+
+	return listVal{typ: e.ReturnType().(*types.ListType), items: items}
+}
+
+func (intr *Interpreter) evaluateIndex(e parser.IndexExpression) Value {
+	list := intr.asList(intr.evaluateExpression(e.List), e.List)
+	index := intr.evaluateExpression(e.Index)
+
+	return list.items[intr.index(list, index, e.Index)]
+}
+
+// evaluateSlice returns the part of the list between the two indexes, sharing its elements.
+// Appending to the slice never overwrites the elements of the list that follow it.
+func (intr *Interpreter) evaluateSlice(e parser.SliceExpression) Value {
+	list := intr.asList(intr.evaluateExpression(e.List), e.List)
+
+	low, high := int64(0), int64(len(list.items))
+	if e.Low != nil {
+		low = intr.asInt(intr.evaluateExpression(e.Low), e.Low)
+	}
+	if e.High != nil {
+		high = intr.asInt(intr.evaluateExpression(e.High), e.High)
+	}
+
+	if low < 0 || low > high || high > int64(len(list.items)) {
+		intr.fail(IndexOutOfRange, e.Span(), "slice bounds %d:%d out of range for list of length %d", low, high, len(list.items))
+	}
+	intr.alloc(e.Span())
+
+	return listVal{typ: list.typ, items: list.items[low:high:high]}
+}
+
+// evaluateIndexAssignment sets the element of a list, which is visible through all lists sharing it.
+// The list and the index are evaluated once, also for compound assignments.
+func (intr *Interpreter) evaluateIndexAssignment(s parser.IndexAssignment) {
+	list := intr.asList(intr.evaluateExpression(s.Target.List), s.Target.List)
+	index := intr.evaluateExpression(s.Target.Index)
+	val := intr.evaluateExpression(s.Value)
+
+	i := intr.index(list, index, s.Target.Index)
+	if s.Op != "" {
+		val = intr.binaryOp(list.items[i], val, parser.BinaryExpression{Left: s.Target, Right: s.Value, Op: s.Op})
+	}
+
+	list.items[i] = val
+}
+
+func (intr *Interpreter) evaluateForEach(s parser.ForEach) control {
+	list := intr.asList(intr.evaluateExpression(s.List), s.List)
+
+	parentScope := intr.activeScope
+	defer func() { intr.activeScope = parentScope }()
+
+	// The list is evaluated once, so elements appended by the body are not visited
+	for _, item := range list.items {
+		// Each iteration gets its own variable, so that closures created in the body keep their element
+		intr.activeScope = newScope(parentScope)
+		intr.activeScope.DeclareVar(s.Var.Name, item)
+
+		ctrl := intr.evaluateBlock(s.Body)
+		intr.step(s.Span())
+		if ctrl == ctrlReturn {
+			return ctrl
+		}
+		if ctrl == ctrlBreak {
+			break
+		}
+	}
+
+	return ctrlNext
+}
+
+func (intr *Interpreter) evaluateBuiltin(e parser.BuiltinCall) Value {
+	var args []Value
+	for _, arg := range e.Args {
+		args = append(args, intr.evaluateExpression(arg))
+	}
+
+	switch e.Name {
+	case "len":
+		intr.alloc(e.Span())
+		return numberVal{value: int64(len(intr.asList(args[0], e.Args[0]).items))}
+
+	case "append":
+		list := intr.asList(args[0], e.Args[0])
+		intr.alloc(e.Span())
+		intr.allocData(e.Span(), len(args)-1)
+		return listVal{typ: list.typ, items: append(list.items, args[1:]...)}
+
+	case "int":
+		// The fraction of a float is discarded
+		return numberVal{value: int64(intr.asFloat(args[0], e.Args[0]))}
+
+	case "float":
+		return floatVal{value: intr.asFloat(args[0], e.Args[0])}
+
+	default:
+		intr.fail(UndefinedFunction, e.Span(), "function %s not defined", e.Name)
+		return nil
+	}
+}
+
+// index returns the position of the element that the index refers to,
+// failing with IndexOutOfRange located at expr if the list has no such element.
+func (intr *Interpreter) index(list listVal, index Value, expr parser.Expression) int {
+	i := intr.asInt(index, expr)
+	if i < 0 || i >= int64(len(list.items)) {
+		intr.fail(IndexOutOfRange, expr.Span(), "index %d out of range for list of length %d", i, len(list.items))
+	}
+
+	return int(i)
+}
+
+// asList returns a list, failing with a type mismatch located at expr if val is something else.
+func (intr *Interpreter) asList(val Value, expr parser.Expression) listVal {
+	list, ok := val.(listVal)
+	if !ok {
+		intr.fail(TypeMismatch, expr.Span(), "expected a list, got %v", typeOf(val))
+	}
+	return list
+}
@@ -8,19 +8,19 @@ import (
 type scope struct {
 	parent *scope
 
-	variables map[string]runtimeVal
+	variables map[string]Value
 	functions map[string]parser.FnDef
 }
 
 func newScope(parent *scope) *scope {
 	return &scope{
 		parent:    parent,
-		variables: make(map[string]runtimeVal),
+		variables: make(map[string]Value),
 		functions: make(map[string]parser.FnDef),
 	}
 }
 
-func (s *scope) GetVar(name string) (runtimeVal, bool) {
+func (s *scope) GetVar(name string) (Value, bool) {
 	val, ok := s.variables[name]
 	if !ok && s.parent != nil {
 		return s.parent.GetVar(name)
@@ -29,7 +29,7 @@ func (s *scope) GetVar(name string) (runtimeVal, bool) {
 	return val, ok
 }
 
-func (s *scope) DeclareVar(name string, val runtimeVal) error {
+func (s *scope) DeclareVar(name string, val Value) error {
 	if _, ok := s.variables[name]; ok {
 		return fmt.Errorf("variable %s already declared", name)
 	}
@@ -38,7 +38,7 @@ func (s *scope) DeclareVar(name string, val runtimeVal) error {
 	return nil
 }
 
-func (s *scope) SetVar(name string, val runtimeVal) error {
+func (s *scope) SetVar(name string, val Value) error {
 	if _, ok := s.variables[name]; !ok {
 		if s.parent != nil {
 			return s.parent.SetVar(name, val)
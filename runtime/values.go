@@ -1,19 +1,255 @@
 package runtime
 
-import "leoscript/types"
+import (
+	"fmt"
+	"leoscript/parser"
+	"leoscript/types"
+	"reflect"
+	"strconv"
+	"strings"
+)
 
-type runtimeVal interface {
+// Value is a value in a running script.
+// The result of a void function is a nil Value.
+type Value interface {
 	Type() types.Type
+	String() string
+
+	// AsInt returns the value as an int64, ok is false if it is not an int.
+	AsInt() (v int64, ok bool)
+	// AsFloat returns the value as a float64, ok is false if it is not a float.
+	AsFloat() (v float64, ok bool)
+	// AsBool returns the value as a bool, ok is false if it is not a bool.
+	AsBool() (v bool, ok bool)
+	// AsString returns the value as a string, ok is false if it is not a string.
+	AsString() (v string, ok bool)
+
+	// Native returns the value as the corresponding Go type, int64, float64, bool or string,
+	// and []any holding the native elements for lists.
+	// Functions have no Go counterpart and are returned as they are.
+	Native() any
 }
 
+// Int returns a LeoScript int. Ints are 64 bits wide on every platform.
+func Int(v int64) Value { return numberVal{value: v} }
+
+// Float returns a LeoScript float.
+func Float(v float64) Value { return floatVal{value: v} }
+
+// Bool returns a LeoScript bool.
+func Bool(v bool) Value { return booleanVal{value: v} }
+
+// String returns a LeoScript string.
+func String(v string) Value { return stringVal{value: v} }
+
+// List returns a LeoScript list of elements of type elem holding the items.
+// It panics if an item is not of type elem.
+func List(elem types.Type, items ...Value) Value {
+	for i, item := range items {
+		if typeOf(item) != elem {
+			panic(fmt.Sprintf("list element %d must be %v, got %v", i, elem, typeOf(item)))
+		}
+	}
+
+	return listVal{typ: types.List(elem), items: items}
+}
+
+// FromNative converts a Go value to the LeoScript value of the corresponding type.
+// A nil input gives a nil Value, the value of void.
+// Slices are converted to lists. Their element type is given by the Go element type,
+// or by their first element for slices of Value or any, which must then not be empty.
+func FromNative(v any) (Value, error) {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+		return listFromNative(rv)
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case Value:
+		return v, nil
+	case int:
+		return Int(int64(v)), nil
+	case int64:
+		return Int(v), nil
+	case float64:
+		return Float(v), nil
+	case bool:
+		return Bool(v), nil
+	case string:
+		return String(v), nil
+	default:
+		return nil, fmt.Errorf("cannot convert %T to a LeoScript value", v)
+	}
+}
+
+// listFromNative converts the Go slice s to a list, see FromNative.
+func listFromNative(s reflect.Value) (Value, error) {
+	items := make([]Value, 0, s.Len())
+	for i := range s.Len() {
+		item, err := FromNative(s.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		items = append(items, item)
+	}
+
+	elem, ok := nativeType(s.Type().Elem())
+	if !ok {
+		if len(items) == 0 {
+			return nil, fmt.Errorf("cannot infer the element type of an empty %v", s.Type())
+		}
+		elem = typeOf(items[0])
+	}
+
+	for i, item := range items {
+		if typeOf(item) != elem {
+			return nil, fmt.Errorf("cannot convert %v: element %d is %v, expected %v", s.Type(), i, typeOf(item), elem)
+		}
+	}
+
+	return List(elem, items...), nil
+}
+
+// nativeType returns the LeoScript type of the values converted from the Go type t by FromNative.
+// ok is false if it depends on the value, like for interfaces.
+func nativeType(t reflect.Type) (typ types.Type, ok bool) {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64:
+		return types.Int, true
+	case reflect.Float64:
+		return types.Float, true
+	case reflect.Bool:
+		return types.Bool, true
+	case reflect.String:
+		return types.String, true
+	case reflect.Slice:
+		elem, ok := nativeType(t.Elem())
+		if !ok {
+			return nil, false
+		}
+		return types.List(elem), true
+	default:
+		return nil, false
+	}
+}
+
+// ToNative converts a LeoScript value to the corresponding Go value, nil for void.
+func ToNative(v Value) any {
+	if v == nil {
+		return nil
+	}
+	return v.Native()
+}
+
+// baseVal holds the accessors that fail for all types, each value type overrides its own.
+type baseVal struct{}
+
+func (baseVal) AsInt() (int64, bool)     { return 0, false }
+func (baseVal) AsFloat() (float64, bool) { return 0, false }
+func (baseVal) AsBool() (bool, bool)     { return false, false }
+func (baseVal) AsString() (string, bool) { return "", false }
+
 type numberVal struct {
-	value int
+	baseVal
+	value int64
 }
 
 func (numberVal) Type() types.Type { return types.Int }
 
+func (v numberVal) String() string { return strconv.FormatInt(v.value, 10) }
+
+func (v numberVal) AsInt() (int64, bool) { return v.value, true }
+
+func (v numberVal) Native() any { return v.value }
+
+type floatVal struct {
+	baseVal
+	value float64
+}
+
+func (floatVal) Type() types.Type { return types.Float }
+
+func (v floatVal) String() string { return strconv.FormatFloat(v.value, 'g', -1, 64) }
+
+func (v floatVal) AsFloat() (float64, bool) { return v.value, true }
+
+func (v floatVal) Native() any { return v.value }
+
 type booleanVal struct {
+	baseVal
 	value bool
 }
 
 func (booleanVal) Type() types.Type { return types.Bool }
+
+func (v booleanVal) String() string { return strconv.FormatBool(v.value) }
+
+func (v booleanVal) AsBool() (bool, bool) { return v.value, true }
+
+func (v booleanVal) Native() any { return v.value }
+
+type stringVal struct {
+	baseVal
+	value string
+}
+
+func (stringVal) Type() types.Type { return types.String }
+
+func (v stringVal) String() string { return v.value }
+
+func (v stringVal) AsString() (string, bool) { return v.value, true }
+
+func (v stringVal) Native() any { return v.value }
+
+// funcVal is a function value, a closure over the scope it was created in or a host function.
+type funcVal struct {
+	baseVal
+	fn parser.FnDef
+	// env is the scope that the function body is evaluated under.
+	env *scope
+	// host is set for host functions, which have no body.
+	host *hostFunction
+}
+
+func (v funcVal) Type() types.Type { return v.fn.Type() }
+
+func (v funcVal) String() string { return fmt.Sprintf("%s %v", v.fn.Name, v.fn.Type()) }
+
+func (v funcVal) Native() any { return v }
+
+// listVal is a list. Like Go slices, lists share their elements with the lists sliced from them and
+// the lists that append returns while they have room to grow, so assigning an element is visible through all of them.
+type listVal struct {
+	baseVal
+	typ   *types.ListType
+	items []Value
+}
+
+func (v listVal) Type() types.Type { return v.typ }
+
+func (v listVal) String() string {
+	items := make([]string, 0, len(v.items))
+	for _, item := range v.items {
+		items = append(items, item.String())
+	}
+
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+func (v listVal) Native() any {
+	items := make([]any, 0, len(v.items))
+	for _, item := range v.items {
+		items = append(items, item.Native())
+	}
+
+	return items
+}
+
+// typeOf returns the type of a value, where nil is the result of a void function.
+func typeOf(val Value) types.Type {
+	if val == nil {
+		return types.Void
+	}
+	return val.Type()
+}
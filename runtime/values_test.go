@@ -0,0 +1,132 @@
+package runtime_test
+
+import (
+	"context"
+	"leoscript/runtime"
+	"leoscript/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Values(t *testing.T) {
+	t.Run("Constructors and accessors", func(t *testing.T) {
+		v := runtime.Int(42)
+		assert.Equal(t, types.Int, v.Type())
+		assert.Equal(t, "42", v.String())
+
+		n, ok := v.AsInt()
+		assert.True(t, ok)
+		assert.Equal(t, int64(42), n)
+
+		_, ok = v.AsBool()
+		assert.False(t, ok)
+
+		b, ok := runtime.Bool(true).AsBool()
+		assert.True(t, ok)
+		assert.True(t, b)
+		assert.Equal(t, "true", runtime.Bool(true).String())
+
+		f, ok := runtime.Float(0.25).AsFloat()
+		assert.True(t, ok)
+		assert.Equal(t, 0.25, f)
+		assert.Equal(t, "0.25", runtime.Float(0.25).String())
+
+		_, ok = v.AsFloat()
+		assert.False(t, ok)
+
+		str, ok := runtime.String("hi").AsString()
+		assert.True(t, ok)
+		assert.Equal(t, "hi", str)
+		assert.Equal(t, types.String, runtime.String("hi").Type())
+
+		_, ok = v.AsString()
+		assert.False(t, ok)
+	})
+
+	t.Run("Native conversion", func(t *testing.T) {
+		v, err := runtime.FromNative(7)
+		assert.NoError(t, err)
+		assert.Equal(t, runtime.Int(7), v)
+		assert.Equal(t, int64(7), runtime.ToNative(v))
+
+		v, err = runtime.FromNative(false)
+		assert.NoError(t, err)
+		assert.Equal(t, false, runtime.ToNative(v))
+
+		v, err = runtime.FromNative("text")
+		assert.NoError(t, err)
+		assert.Equal(t, runtime.String("text"), v)
+		assert.Equal(t, "text", runtime.ToNative(v))
+
+		v, err = runtime.FromNative(nil)
+		assert.NoError(t, err)
+		assert.Nil(t, v)
+		assert.Nil(t, runtime.ToNative(v))
+
+		v, err = runtime.FromNative(1.5)
+		assert.NoError(t, err)
+		assert.Equal(t, runtime.Float(1.5), v)
+		assert.Equal(t, 1.5, runtime.ToNative(v))
+
+		_, err = runtime.FromNative(float32(1.5))
+		assert.ErrorContains(t, err, "cannot convert float32")
+	})
+
+	t.Run("Lists", func(t *testing.T) {
+		list := runtime.List(types.Int, runtime.Int(1), runtime.Int(2))
+		assert.Equal(t, types.List(types.Int), list.Type())
+		assert.Equal(t, "[1, 2]", list.String())
+		assert.Equal(t, []any{int64(1), int64(2)}, runtime.ToNative(list))
+
+		assert.PanicsWithValue(t, "list element 1 must be int, got string", func() {
+			runtime.List(types.Int, runtime.Int(1), runtime.String("a"))
+		})
+
+		v, err := runtime.FromNative([]int{1, 2})
+		assert.NoError(t, err)
+		assert.Equal(t, list, v)
+
+		v, err = runtime.FromNative([][]string{{"a"}, {}})
+		assert.NoError(t, err)
+		assert.Equal(t, types.List(types.List(types.String)), v.Type())
+		assert.Equal(t, []any{[]any{"a"}, []any{}}, runtime.ToNative(v))
+
+		v, err = runtime.FromNative([]float64{})
+		assert.NoError(t, err)
+		assert.Equal(t, types.List(types.Float), v.Type())
+		assert.Equal(t, "[]", v.String())
+
+		// The element type of slices of any is given by their first element
+		v, err = runtime.FromNative([]any{true, runtime.Bool(false)})
+		assert.NoError(t, err)
+		assert.Equal(t, runtime.List(types.Bool, runtime.Bool(true), runtime.Bool(false)), v)
+
+		_, err = runtime.FromNative([]any{})
+		assert.EqualError(t, err, "cannot infer the element type of an empty []interface {}")
+
+		_, err = runtime.FromNative([]any{1, "a"})
+		assert.EqualError(t, err, "cannot convert []interface {}: element 1 is string, expected int")
+
+		_, err = runtime.FromNative([]float32{1.5})
+		assert.EqualError(t, err, "element 0: cannot convert float32 to a LeoScript value")
+	})
+
+	t.Run("Result of main from another package", func(t *testing.T) {
+		i := runtime.New()
+
+		err := i.LoadRaw(`
+			fn main() int {
+				return 6 * 7;
+			}
+		`)
+		assert.NoError(t, err)
+
+		resp, err := i.Run(context.Background())
+		assert.NoError(t, err)
+
+		n, ok := resp.AsInt()
+		assert.True(t, ok)
+		assert.Equal(t, int64(42), n)
+	})
+}
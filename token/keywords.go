@@ -0,0 +1,54 @@
+package token
+
+import "leoscript/types"
+
+// keywords maps the reserved words to the token they are lexed as.
+var keywords = map[string]Token{
+	"true":     Boolean{Value: true},
+	"false":    Boolean{Value: false},
+	"var":      VarDecl{},
+	"const":    Const{},
+	"int":      Type{Kind: types.Int},
+	"float":    Type{Kind: types.Float},
+	"bool":     Type{Kind: types.Bool},
+	"string":   Type{Kind: types.String},
+	"fn":       FnDef{},
+	"return":   Return{},
+	"if":       If{},
+	"else":     Else{},
+	"while":    While{},
+	"for":      For{},
+	"break":    Break{},
+	"continue": Continue{},
+	"in":       In{},
+}
+
+// LookupKeyword returns the token of a reserved word, ok is false if name is not reserved.
+func LookupKeyword(name string) (tk Token, ok bool) {
+	tk, ok = keywords[name]
+	return tk, ok
+}
+
+// KeywordName returns the reserved word that a token is lexed from, ok is false if it is not a keyword.
+func KeywordName(tk Token) (name string, ok bool) {
+	for name, kw := range keywords {
+		if kw.Type() != tk.Type() {
+			continue
+		}
+
+		switch tk := tk.(type) {
+		case Type:
+			if kw.(Type).Kind != tk.Kind {
+				continue
+			}
+		case Boolean:
+			if kw.(Boolean).Value != tk.Value {
+				continue
+			}
+		}
+
+		return name, true
+	}
+
+	return "", false
+}
@@ -3,6 +3,7 @@ package token
 // Use the same orders as in C: https://en.cppreference.com/w/c/language/operator_precedence
 
 // Order Of OPerations of binary operators, ooops!
+// An operator binds its operands tighter the higher its priority is.
 type Priority int
 
 const (
@@ -15,6 +16,15 @@ const (
 	PRIO_COMPARISON // >, <, >=, <=
 	PRIO_SUM        // + and -
 	PRIO_PRODUCT    // * and /
+	PRIO_PREFIX     // -, + and ! in front of an operand
+)
+
+// Associativity decides how a chain of operators with the same priority is grouped.
+type Associativity int
 
-	PRIO_PAREN Priority = 100 // ()
+const (
+	// LeftAssoc groups from the left, a - b - c is (a - b) - c.
+	LeftAssoc Associativity = iota
+	// RightAssoc groups from the right, a = b = c is a = (b = c).
+	RightAssoc
 )
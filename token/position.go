@@ -0,0 +1,71 @@
+package token
+
+import "fmt"
+
+// Position is a single location in a source file.
+// Line and Column are 1-based, Offset is the 0-based byte offset into the source.
+type Position struct {
+	File   string
+	Offset int
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position has been set.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String formats the position as file:line:column, leaving out the parts that are unknown.
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.File != "" {
+			return p.File
+		}
+		return "-"
+	}
+
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Span is the range of source code that a token or syntax node was produced from.
+// End points one past the last byte of the range.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+func (s Span) String() string {
+	return s.Start.String()
+}
+
+// Join returns a span covering both s and other.
+func (s Span) Join(other Span) Span {
+	if !s.Start.IsValid() {
+		return other
+	}
+	if !other.Start.IsValid() {
+		return s
+	}
+
+	joined := s
+	if other.Start.Offset < joined.Start.Offset {
+		joined.Start = other.Start
+	}
+	if other.End.Offset > joined.End.Offset {
+		joined.End = other.End
+	}
+
+	return joined
+}
+
+// spanned is embedded in every token to carry its location in the source.
+type spanned struct {
+	span Span
+}
+
+func (s spanned) Span() Span { return s.span }
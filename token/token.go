@@ -4,54 +4,95 @@ import "leoscript/types"
 
 type Token interface {
 	Type() TokenType
+	// Span is the location in the source that the token was read from.
+	Span() Span
+	// WithSpan returns a copy of the token located at the given span.
+	WithSpan(Span) Token
 }
 
-//go:generate go run golang.org/x/tools/cmd/stringer -type=TokenType
+//go:generate go run golang.org/x/tools/cmd/stringer -type=TokenType -linecomment
 
 type TokenType int
 
 const (
-	EOFType TokenType = iota
+	EOFType TokenType = iota // end of file
 
 	// Literals
-	IntegerType
-	BooleanType
+	IntegerType // integer literal
+	FloatType   // float literal
+	BooleanType // boolean literal
+	StringType  // string literal
 
 	// Parentheses
-	OpenParenType
-	CloseParenType
-	OpenBraceType
-	CloseBraceType
-
-	VarDeclType
-	TypeType // lol
-	SemicolonType
-	IdentifierType
-	OperatorType
-	FnDefType
-	ReturnType
-	CommaType
+	OpenParenType    // (
+	CloseParenType   // )
+	OpenBraceType    // {
+	CloseBraceType   // }
+	OpenBracketType  // [
+	CloseBracketType // ]
+
+	VarDeclType    // var
+	TypeType       // type name
+	SemicolonType  // ;
+	IdentifierType // identifier
+	OperatorType   // operator
+	FnDefType      // fn
+	ReturnType     // return
+	CommaType      // ,
+	IfType         // if
+	ElseType       // else
+	WhileType      // while
+	ForType        // for
+	BreakType      // break
+	ContinueType   // continue
+	ConstType      // const
+	ColonType      // :
+	InType         // in
 )
 
-type EOF struct{}
+type EOF struct {
+	spanned
+}
 
 func (EOF) Type() TokenType { return EOFType }
 
+func (t EOF) WithSpan(s Span) Token { t.span = s; return t }
+
 type Integer struct {
-	Value int
+	Value int64
+
+	spanned
 }
 
 func (Integer) Type() TokenType { return IntegerType }
 
+func (t Integer) WithSpan(s Span) Token { t.span = s; return t }
+
+type Float struct {
+	Value float64
+
+	spanned
+}
+
+func (Float) Type() TokenType { return FloatType }
+
+func (t Float) WithSpan(s Span) Token { t.span = s; return t }
+
 type Operator struct {
 	Op string
+
+	spanned
 }
 
 func (Operator) Type() TokenType { return OperatorType }
 
+func (t Operator) WithSpan(s Span) Token { t.span = s; return t }
+
+// Priority returns the binding power of the operator when it is used between two operands.
+// Operators that cannot be used that way, like !, have no priority and return 0.
 func (t Operator) Priority() Priority {
 	switch t.Op {
-	case "=":
+	case "=", "+=", "-=", "*=", "/=":
 		return PRIO_ASSIGN
 	case "==", "!=":
 		return PRIO_EQUALS
@@ -67,10 +108,22 @@ func (t Operator) Priority() Priority {
 		return PRIO_PRODUCT
 	}
 
-	panic("invalid operator in binary expression")
+	return 0
 }
 
-type OpenParen struct{}
+// Associativity returns how the operator groups with others of the same priority.
+func (t Operator) Associativity() Associativity {
+	switch t.Op {
+	case "=", "+=", "-=", "*=", "/=":
+		return RightAssoc
+	}
+
+	return LeftAssoc
+}
+
+type OpenParen struct {
+	spanned
+}
 
 func (OpenParen) String() string {
 	return "{(}"
@@ -78,7 +131,11 @@ func (OpenParen) String() string {
 
 func (OpenParen) Type() TokenType { return OpenParenType }
 
-type CloseParen struct{}
+func (t OpenParen) WithSpan(s Span) Token { t.span = s; return t }
+
+type CloseParen struct {
+	spanned
+}
 
 func (CloseParen) String() string {
 	return "{)}"
@@ -86,7 +143,35 @@ func (CloseParen) String() string {
 
 func (CloseParen) Type() TokenType { return CloseParenType }
 
-type Semicolon struct{}
+func (t CloseParen) WithSpan(s Span) Token { t.span = s; return t }
+
+type OpenBracket struct {
+	spanned
+}
+
+func (OpenBracket) Type() TokenType { return OpenBracketType }
+
+func (t OpenBracket) WithSpan(s Span) Token { t.span = s; return t }
+
+type CloseBracket struct {
+	spanned
+}
+
+func (CloseBracket) Type() TokenType { return CloseBracketType }
+
+func (t CloseBracket) WithSpan(s Span) Token { t.span = s; return t }
+
+type Colon struct {
+	spanned
+}
+
+func (Colon) Type() TokenType { return ColonType }
+
+func (t Colon) WithSpan(s Span) Token { t.span = s; return t }
+
+type Semicolon struct {
+	spanned
+}
 
 func (Semicolon) String() string {
 	return "{;}"
@@ -94,44 +179,160 @@ func (Semicolon) String() string {
 
 func (Semicolon) Type() TokenType { return SemicolonType }
 
+func (t Semicolon) WithSpan(s Span) Token { t.span = s; return t }
+
 type Identifier struct {
 	Value string
+
+	spanned
 }
 
 func (Identifier) Type() TokenType { return IdentifierType }
 
+func (t Identifier) WithSpan(s Span) Token { t.span = s; return t }
+
 type Boolean struct {
 	Value bool
+
+	spanned
 }
 
 func (Boolean) Type() TokenType { return BooleanType }
 
-type VarDecl struct{}
+func (t Boolean) WithSpan(s Span) Token { t.span = s; return t }
+
+// String is a string literal, Value holds the text with all escape sequences resolved.
+type String struct {
+	Value string
+
+	spanned
+}
+
+func (String) Type() TokenType { return StringType }
+
+func (t String) WithSpan(s Span) Token { t.span = s; return t }
+
+type VarDecl struct {
+	spanned
+}
 
 func (VarDecl) Type() TokenType { return VarDeclType }
 
-type FnDef struct{}
+func (t VarDecl) WithSpan(s Span) Token { t.span = s; return t }
+
+type Const struct {
+	spanned
+}
+
+func (Const) Type() TokenType { return ConstType }
+
+func (t Const) WithSpan(s Span) Token { t.span = s; return t }
+
+type FnDef struct {
+	// Doc is the text of the comments directly preceding the fn keyword, empty if there are none.
+	Doc string
+
+	spanned
+}
 
 func (FnDef) Type() TokenType { return FnDefType }
 
-type OpenBrace struct{}
+func (t FnDef) WithSpan(s Span) Token { t.span = s; return t }
+
+type OpenBrace struct {
+	spanned
+}
 
 func (OpenBrace) Type() TokenType { return OpenBraceType }
 
-type CloseBrace struct{}
+func (t OpenBrace) WithSpan(s Span) Token { t.span = s; return t }
+
+type CloseBrace struct {
+	spanned
+}
 
 func (CloseBrace) Type() TokenType { return CloseBraceType }
 
-type Return struct{}
+func (t CloseBrace) WithSpan(s Span) Token { t.span = s; return t }
+
+type Return struct {
+	spanned
+}
 
 func (Return) Type() TokenType { return ReturnType }
 
+func (t Return) WithSpan(s Span) Token { t.span = s; return t }
+
 type Type struct {
 	Kind types.Type
+
+	spanned
 }
 
 func (Type) Type() TokenType { return TypeType }
 
-type Comma struct{}
+func (t Type) WithSpan(s Span) Token { t.span = s; return t }
+
+type Comma struct {
+	spanned
+}
 
 func (Comma) Type() TokenType { return CommaType }
+
+func (t Comma) WithSpan(s Span) Token { t.span = s; return t }
+
+type If struct {
+	spanned
+}
+
+func (If) Type() TokenType { return IfType }
+
+func (t If) WithSpan(s Span) Token { t.span = s; return t }
+
+type Else struct {
+	spanned
+}
+
+func (Else) Type() TokenType { return ElseType }
+
+func (t Else) WithSpan(s Span) Token { t.span = s; return t }
+
+type While struct {
+	spanned
+}
+
+func (While) Type() TokenType { return WhileType }
+
+func (t While) WithSpan(s Span) Token { t.span = s; return t }
+
+type For struct {
+	spanned
+}
+
+func (For) Type() TokenType { return ForType }
+
+func (t For) WithSpan(s Span) Token { t.span = s; return t }
+
+type Break struct {
+	spanned
+}
+
+func (Break) Type() TokenType { return BreakType }
+
+func (t Break) WithSpan(s Span) Token { t.span = s; return t }
+
+type Continue struct {
+	spanned
+}
+
+func (Continue) Type() TokenType { return ContinueType }
+
+func (t Continue) WithSpan(s Span) Token { t.span = s; return t }
+
+type In struct {
+	spanned
+}
+
+func (In) Type() TokenType { return InType }
+
+func (t In) WithSpan(s Span) Token { t.span = s; return t }
@@ -0,0 +1,518 @@
+package typecheck
+
+import (
+	"fmt"
+	"leoscript/diag"
+	"leoscript/parser"
+	"leoscript/token"
+	"leoscript/types"
+)
+
+// Check verifies the types of all statements and expressions in a parsed program.
+// scope declares the functions available to the program besides its own, like host functions, and may be nil.
+// All problems found are returned together as diag.Diagnostics.
+func Check(prog parser.Program, scope *parser.Scope) error {
+	c := checker{scope: parser.NewScope(scope)}
+
+	// Top-level declarations are visible in every function body, whatever their order in the file.
+	for _, stmt := range prog.Body {
+		switch s := stmt.(type) {
+		case parser.FnDef:
+			c.scope.RegisterFn(s)
+		case parser.VarDecl:
+			c.scope.RegisterVar(s)
+		}
+	}
+
+	for _, stmt := range prog.Body {
+		c.checkStatement(stmt)
+	}
+
+	c.diags.Sort()
+	return c.diags.Err()
+}
+
+type checker struct {
+	scope *parser.Scope
+
+	// fn is the function whose body is being checked, to verify its return statements.
+	fn parser.FnDef
+
+	diags diag.Diagnostics
+}
+
+// errorf reports a type mismatch located at the given span.
+func (c *checker) errorf(span token.Span, format string, args ...any) {
+	c.diags.Add(diag.Errorf(diag.CodeTypeMismatch, span, format, args...))
+}
+
+func (c *checker) checkStatement(stmt parser.Statement) {
+	switch s := stmt.(type) {
+	case parser.VarDecl:
+		if t := c.typeOf(s.Value); t != nil && t != s.Type {
+			c.errorf(s.Value.Span(), "type mismatch: expected %v, got %v", s.Type, t)
+		}
+		// Top-level variables are already registered, which makes this a no-op for them
+		c.scope.RegisterVar(s)
+
+	case parser.Assignment:
+		t := c.typeOf(s.Value)
+		decl, ok := c.scope.ResolveVar(s.Name)
+		if !ok {
+			if _, ok := c.scope.ResolveFn(s.Name); ok {
+				c.diags.Add(diag.Errorf(diag.CodeConstAssign, s.Span(), "cannot assign to function %s", s.Name))
+			}
+		} else if t != nil && t != decl.Type {
+			c.errorf(s.Value.Span(), "cannot assign %v to %s of type %v", t, s.Name, decl.Type)
+		}
+
+	case parser.IndexAssignment:
+		elem, t := c.typeOf(s.Target), c.typeOf(s.Value)
+		if s.Op != "" {
+			t = c.typeOf(parser.BinaryExpression{Left: s.Target, Right: s.Value, Op: s.Op})
+		}
+		if elem != nil && t != nil && t != elem {
+			c.errorf(s.Value.Span(), "cannot assign %v to an element of type %v", t, elem)
+		}
+
+	case parser.FnDef:
+		c.checkFnDef(s)
+
+	case parser.Call:
+		// The result of a call statement is discarded, so void functions are allowed here
+		c.callType(s)
+
+	case parser.Return:
+		c.checkReturn(s)
+
+	case parser.If:
+		c.checkCondition(s.Condition, "if condition")
+		c.checkBlock(s.Body)
+		c.checkBlock(s.Else)
+
+	case parser.While:
+		c.checkCondition(s.Condition, "condition")
+		c.checkBlock(s.Body)
+
+	case parser.For:
+		// The init statement gets its own scope, like in the interpreter
+		parentScope := c.scope
+		c.scope = parser.NewScope(parentScope)
+		defer func() { c.scope = parentScope }()
+
+		if s.Init != nil {
+			c.checkStatement(s.Init)
+		}
+		if s.Condition != nil {
+			c.checkCondition(s.Condition, "condition")
+		}
+		if s.Post != nil {
+			c.checkStatement(s.Post)
+		}
+		c.checkBlock(s.Body)
+
+	case parser.ForEach:
+		c.typeOf(s.List)
+
+		// The loop variable is only visible in the body, like in the interpreter
+		parentScope := c.scope
+		c.scope = parser.NewScope(parentScope)
+		defer func() { c.scope = parentScope }()
+
+		c.scope.RegisterVar(s.Var)
+		c.checkBlock(s.Body)
+
+	case parser.Block:
+		c.checkBlock(s.Body)
+
+	case parser.Break, parser.Continue:
+
+	default:
+		panic(fmt.Sprintf("unknown statement: %T, v=%+v", s, s))
+	}
+}
+
+func (c *checker) checkFnDef(fn parser.FnDef) {
+	parentScope, parentFn := c.scope, c.fn
+	c.scope, c.fn = parser.NewScope(parentScope), fn
+	defer func() { c.scope, c.fn = parentScope, parentFn }()
+
+	for _, arg := range fn.Args {
+		c.scope.RegisterVar(parser.VarDecl{Name: arg.Name, Type: arg.Type})
+	}
+
+	for _, stmt := range fn.Body {
+		c.checkStatement(stmt)
+	}
+
+	// A statement left out of the body because of a syntax error may have been its return
+	if fn.ReturnType != types.Void && !fn.Incomplete() && !terminates(fn.Body) {
+		c.diags.Add(diag.Errorf(diag.CodeMissingReturn, fn.Span(), "%s must return %v on every path", fn.Name, fn.ReturnType))
+	}
+}
+
+// terminates reports whether every path through the statements ends in a return,
+// so that execution can never continue past them.
+func terminates(stmts []parser.Statement) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+
+	switch s := stmts[len(stmts)-1].(type) {
+	case parser.Return:
+		return true
+	case parser.Block:
+		return terminates(s.Body)
+	case parser.If:
+		return s.Else != nil && terminates(s.Body) && terminates(s.Else)
+	case parser.For:
+		// A loop without a condition can only be left by a break or a return
+		return s.Condition == nil && !breaks(s.Body)
+	case parser.While:
+		// Like for (;;), while (true) can only be left by a break or a return
+		cond, ok := s.Condition.(parser.BooleanLiteral)
+		return ok && cond.Value && !breaks(s.Body)
+	}
+
+	return false
+}
+
+// breaks reports whether the statements contain a break out of the loop that encloses them.
+// Breaks inside nested loops belong to those loops and are not counted.
+func breaks(stmts []parser.Statement) bool {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case parser.Break:
+			return true
+		case parser.Block:
+			if breaks(s.Body) {
+				return true
+			}
+		case parser.If:
+			if breaks(s.Body) || breaks(s.Else) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkBlock checks the statements in a new scope.
+func (c *checker) checkBlock(stmts []parser.Statement) {
+	parentScope := c.scope
+	c.scope = parser.NewScope(parentScope)
+	defer func() { c.scope = parentScope }()
+
+	for _, stmt := range stmts {
+		c.checkStatement(stmt)
+	}
+}
+
+func (c *checker) checkReturn(s parser.Return) {
+	if s.Value == nil {
+		if c.fn.ReturnType != types.Void {
+			c.errorf(s.Span(), "%s must return %v", c.fn.Name, c.fn.ReturnType)
+		}
+		return
+	}
+
+	t := c.typeOf(s.Value)
+	if c.fn.ReturnType == types.Void {
+		c.errorf(s.Value.Span(), "%s does not return a value", c.fn.Name)
+		return
+	}
+
+	if t != nil && t != c.fn.ReturnType {
+		c.errorf(s.Value.Span(), "%s must return %v, got %v", c.fn.Name, c.fn.ReturnType, t)
+	}
+}
+
+// checkCondition verifies that the condition of an if or a loop is a bool.
+func (c *checker) checkCondition(cond parser.Expression, what string) {
+	if t := c.typeOf(cond); t != nil && t != types.Bool {
+		c.errorf(cond.Span(), "%s must be %v, got %v", what, types.Bool, t)
+	}
+}
+
+// typeOf resolves the type of an expression and reports the mismatches found in it.
+// It returns nil if the type cannot be resolved because of an error, which has then already been reported.
+func (c *checker) typeOf(expr parser.Expression) types.Type {
+	switch e := expr.(type) {
+	case parser.IntegerLiteral, parser.FloatLiteral, parser.BooleanLiteral, parser.StringLiteral:
+		return e.ReturnType()
+
+	case parser.Identifier:
+		if decl, ok := c.scope.ResolveVar(e.Name); ok {
+			return decl.Type
+		}
+		return e.ReturnType()
+
+	case parser.Call:
+		t := c.callType(e)
+		if t == types.Void {
+			c.errorf(e.Span(), "%s does not return a value and cannot be used as one", e.Name)
+			return nil
+		}
+		return t
+
+	case parser.UnaryExpression:
+		return c.unaryType(e)
+
+	case parser.BinaryExpression:
+		return c.binaryType(e)
+
+	case parser.FnLiteral:
+		// The body sees the variables of the enclosing scopes that the function closes over
+		c.checkFnDef(e.Fn)
+		return e.ReturnType()
+
+	case parser.ListLiteral:
+		return c.listType(e)
+
+	case parser.IndexExpression:
+		listType := c.indexedType(e.List)
+		c.checkIndex(e.Index)
+		if listType == nil {
+			return nil
+		}
+		return listType.Elem
+
+	case parser.SliceExpression:
+		listType := c.indexedType(e.List)
+		c.checkIndex(e.Low)
+		c.checkIndex(e.High)
+		if listType == nil {
+			return nil
+		}
+		return listType
+
+	case parser.BuiltinCall:
+		return c.builtinType(e)
+
+	default:
+		panic(fmt.Sprintf("unknown expression: %T, v=%+v", e, e))
+	}
+}
+
+func (c *checker) callType(call parser.Call) types.Type {
+	name, fnType := c.calleeType(call)
+	if fnType == nil {
+		for _, arg := range call.Args {
+			c.typeOf(arg)
+		}
+		return nil
+	}
+
+	if len(call.Args) != len(fnType.Params) {
+		c.diags.Add(diag.Errorf(diag.CodeArgumentCount, call.Span(), "%s expects %d arguments, got %d", name, len(fnType.Params), len(call.Args)))
+	}
+
+	for i, arg := range call.Args {
+		t := c.typeOf(arg)
+		if len(call.Args) == len(fnType.Params) && t != nil && t != fnType.Params[i] {
+			c.errorf(arg.Span(), "argument %d of %s must be %v, got %v", i+1, name, fnType.Params[i], t)
+		}
+	}
+
+	return fnType.Return
+}
+
+// calleeType resolves the type of the function called and the name to refer to it by in errors.
+// The type is nil if the callee is not a function or cannot be resolved.
+func (c *checker) calleeType(call parser.Call) (string, *types.FuncType) {
+	if call.Callee != nil {
+		t := c.typeOf(call.Callee)
+		if t == nil {
+			return "", nil
+		}
+
+		fnType, ok := t.(*types.FuncType)
+		if !ok {
+			c.errorf(call.Callee.Span(), "cannot call %v", t)
+			return "", nil
+		}
+		return "function", fnType
+	}
+
+	// Variables are resolved before functions, like in the parser
+	if decl, ok := c.scope.ResolveVar(call.Name); ok {
+		fnType, ok := decl.Type.(*types.FuncType)
+		if !ok {
+			c.errorf(call.Span(), "%s is not a function, it is %v", call.Name, decl.Type)
+			return "", nil
+		}
+		return call.Name, fnType
+	}
+
+	if fn, ok := c.scope.ResolveFn(call.Name); ok {
+		return fn.Name, fn.Type().(*types.FuncType)
+	}
+
+	// Left unchecked like the rest of the call, the parser has reported it
+	return call.Name, nil
+}
+
+func (c *checker) unaryType(e parser.UnaryExpression) types.Type {
+	t := c.typeOf(e.Expression)
+	if t == nil {
+		return nil
+	}
+
+	switch {
+	case (e.Op == "-" || e.Op == "+") && isNumber(t):
+		return t
+	case e.Op == "!" && t == types.Bool:
+		return t
+	}
+
+	c.errorf(e.Span(), "operator %s cannot be used with %v", e.Op, t)
+	return nil
+}
+
+func (c *checker) binaryType(e parser.BinaryExpression) types.Type {
+	left, right := c.typeOf(e.Left), c.typeOf(e.Right)
+	if left == nil || right == nil {
+		return nil
+	}
+
+	switch e.Op {
+	case "&&", "||":
+		if left == types.Bool && right == types.Bool {
+			return types.Bool
+		}
+
+	case "+", "-", "*", "/":
+		// + concatenates strings
+		if e.Op == "+" && left == types.String && right == types.String {
+			return types.String
+		}
+
+		// An int operand is promoted to float if the other operand is a float
+		if isNumber(left) && isNumber(right) {
+			if left == types.Float || right == types.Float {
+				return types.Float
+			}
+			return types.Int
+		}
+
+	case "<", ">", "<=", ">=":
+		if isNumber(left) && isNumber(right) || left == types.String && right == types.String {
+			return types.Bool
+		}
+
+	case "==", "!=":
+		// Functions and lists cannot be compared
+		_, isFn := left.(*types.FuncType)
+		_, isList := left.(*types.ListType)
+		if isNumber(left) && isNumber(right) || left == right && left != types.Void && !isFn && !isList {
+			return types.Bool
+		}
+
+	default:
+		panic(fmt.Sprintf("unknown binary operator: %s", e.Op))
+	}
+
+	c.errorf(e.Span(), "operator %s cannot be used with %v and %v", e.Op, left, right)
+	return nil
+}
+
+func isNumber(t types.Type) bool {
+	return t == types.Int || t == types.Float
+}
+
+// listType checks that all elements of a list literal have its element type.
+func (c *checker) listType(lit parser.ListLiteral) types.Type {
+	listType, ok := lit.ReturnType().(*types.ListType)
+	if !ok {
+		c.errorf(lit.Span(), "cannot infer the type of an empty list")
+		return nil
+	}
+
+	for _, elem := range lit.Elems {
+		if t := c.typeOf(elem); t != nil && t != listType.Elem {
+			c.errorf(elem.Span(), "list element must be %v, got %v", listType.Elem, t)
+		}
+	}
+
+	return listType
+}
+
+// indexedType returns the type of the list that is indexed or sliced, nil if it is not a list.
+func (c *checker) indexedType(list parser.Expression) *types.ListType {
+	t := c.typeOf(list)
+	if t == nil {
+		return nil
+	}
+
+	listType, ok := t.(*types.ListType)
+	if !ok {
+		c.errorf(list.Span(), "cannot index %v", t)
+		return nil
+	}
+
+	return listType
+}
+
+// checkIndex verifies that an index into a list is an int. A nil index is one left out of a slice.
+func (c *checker) checkIndex(index parser.Expression) {
+	if index == nil {
+		return
+	}
+
+	if t := c.typeOf(index); t != nil && t != types.Int {
+		c.errorf(index.Span(), "list index must be %v, got %v", types.Int, t)
+	}
+}
+
+// builtinType checks the arguments of a call of a builtin function and returns its result type.
+func (c *checker) builtinType(call parser.BuiltinCall) types.Type {
+	argTypes := make([]types.Type, 0, len(call.Args))
+	for _, arg := range call.Args {
+		argTypes = append(argTypes, c.typeOf(arg))
+	}
+
+	switch call.Name {
+	case "len":
+		if len(call.Args) != 1 {
+			c.diags.Add(diag.Errorf(diag.CodeArgumentCount, call.Span(), "len expects 1 argument, got %d", len(call.Args)))
+			return types.Int
+		}
+
+		if _, ok := argTypes[0].(*types.ListType); !ok && argTypes[0] != nil {
+			c.errorf(call.Args[0].Span(), "argument of len must be a list, got %v", argTypes[0])
+		}
+		return types.Int
+
+	case "append":
+		// The parser requires the list argument
+		listType, ok := argTypes[0].(*types.ListType)
+		if !ok {
+			if argTypes[0] != nil {
+				c.errorf(call.Args[0].Span(), "first argument of append must be a list, got %v", argTypes[0])
+			}
+			return nil
+		}
+
+		for i, t := range argTypes[1:] {
+			if t != nil && t != listType.Elem {
+				c.errorf(call.Args[i+1].Span(), "argument %d of append must be %v, got %v", i+2, listType.Elem, t)
+			}
+		}
+		return listType
+
+	case "int", "float":
+		if len(call.Args) != 1 {
+			c.diags.Add(diag.Errorf(diag.CodeArgumentCount, call.Span(), "%s expects 1 argument, got %d", call.Name, len(call.Args)))
+			return call.ReturnType()
+		}
+
+		if t := argTypes[0]; t != nil && !isNumber(t) {
+			c.errorf(call.Args[0].Span(), "cannot convert %v to %v", t, call.ReturnType())
+		}
+		return call.ReturnType()
+
+	default:
+		panic(fmt.Sprintf("unknown builtin function: %s", call.Name))
+	}
+}
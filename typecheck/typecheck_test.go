@@ -0,0 +1,334 @@
+package typecheck_test
+
+import (
+	"leoscript/diag"
+	"leoscript/lexer"
+	"leoscript/parser"
+	"leoscript/typecheck"
+	"leoscript/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// check parses the source and type checks it against the given scope.
+func check(t *testing.T, src string, scope *parser.Scope) error {
+	t.Helper()
+
+	prog, err := parser.NewParser(lexer.MustTokenize(src), scope).ParseFile()
+	assert.NoError(t, err)
+
+	return typecheck.Check(prog, scope)
+}
+
+func Test_Check(t *testing.T) {
+	t.Run("Valid program", func(t *testing.T) {
+		err := check(t, `
+var limit = 10;
+
+fn label(int n, bool loud) string {
+	var s = "n";
+	if (loud && n > 2) {
+		s = s + "!";
+	}
+	return s;
+}
+
+fn main() float {
+	float total = 0.5;
+	for (var i = 0; i < limit; i = i + 1) {
+		total = total + i * 1.5;
+	}
+	while (label(2, false) == "n") {
+		return -total;
+	}
+	return total / 2;
+}
+`, nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Binary operands", func(t *testing.T) {
+		err := check(t, "fn main() int {\n\treturn 1 + true;\n}", nil)
+		assert.EqualError(t, err, "2:9: operator + cannot be used with int and bool")
+
+		err = check(t, `fn f() bool { return "a" < 1 || 1.5 == true; }`, nil)
+		assert.EqualError(t, err, "1:22: operator < cannot be used with string and int\n1:33: operator == cannot be used with float and bool")
+
+		err = check(t, `fn f() string { return "n=" + 1; }`, nil)
+		assert.EqualError(t, err, "1:24: operator + cannot be used with string and int")
+	})
+
+	t.Run("Unary operands", func(t *testing.T) {
+		err := check(t, `fn f() bool { return !1 == -true; }`, nil)
+		assert.EqualError(t, err, "1:22: operator ! cannot be used with int\n1:28: operator - cannot be used with bool")
+	})
+
+	t.Run("Errors are not repeated by enclosing expressions", func(t *testing.T) {
+		err := check(t, `fn f() int { return (1 + true) * 2 - 3; }`, nil)
+		assert.EqualError(t, err, "1:22: operator + cannot be used with int and bool")
+	})
+
+	t.Run("Return values", func(t *testing.T) {
+		err := check(t, `
+fn a() int { return true; }
+fn b() { return 1; }
+fn c() string { return; }
+`, nil)
+		assert.EqualError(t, err, "2:21: a must return int, got bool\n3:17: b does not return a value\n4:17: c must return string")
+	})
+
+	t.Run("Variable declarations", func(t *testing.T) {
+		err := check(t, "fn main() int {\n  int a = true;\n  return a;\n}", nil)
+		assert.EqualError(t, err, "2:11: type mismatch: expected int, got bool")
+
+		err = check(t, "fn f() {\nfloat price = 1.5;\nint total = price * 2;\n}", nil)
+		assert.EqualError(t, err, "3:13: type mismatch: expected int, got float")
+	})
+
+	t.Run("Assignments", func(t *testing.T) {
+		err := check(t, `
+var count = 0;
+
+fn f() {
+	count = "many";
+	bool b = true;
+	b = 1 > 0;
+	b = 2;
+	count += 1.5;
+	b++;
+}
+`, nil)
+		assert.EqualError(t, err, "5:10: cannot assign string to count of type int\n8:6: cannot assign int to b of type bool\n"+
+			"9:2: cannot assign float to count of type int\n10:2: operator + cannot be used with bool and int")
+	})
+
+	t.Run("Conditions", func(t *testing.T) {
+		err := check(t, `
+fn f() {
+	if (1 + 2) {}
+	while (1) {}
+	for (;"x";) {}
+}
+`, nil)
+		assert.EqualError(t, err, "3:6: if condition must be bool, got int\n4:9: condition must be bool, got int\n5:8: condition must be bool, got string")
+	})
+
+	t.Run("Call arguments", func(t *testing.T) {
+		scope := parser.NewScope(nil)
+		scope.RegisterFn(parser.FnDef{
+			Name:       "foo",
+			ReturnType: types.Bool,
+			Args:       []parser.Argument{{Name: "a", Type: types.Int}, {Name: "b", Type: types.Bool}},
+		})
+
+		err := check(t, `
+fn f() bool {
+	foo(1);
+	foo(1, 2);
+	return foo(1 + true, false);
+}
+`, scope)
+		assert.EqualError(t, err, "3:2: foo expects 2 arguments, got 1\n4:9: argument 2 of foo must be bool, got int\n5:13: operator + cannot be used with int and bool")
+
+		var diags diag.Diagnostics
+		assert.ErrorAs(t, err, &diags)
+		assert.Equal(t, diag.CodeArgumentCount, diags[0].Code)
+		assert.Equal(t, diag.CodeTypeMismatch, diags[1].Code)
+	})
+
+	t.Run("Calls to functions declared later", func(t *testing.T) {
+		err := check(t, `
+fn main() int {
+	return twice(true);
+}
+
+fn twice(int n) int {
+	return n * 2;
+}
+`, nil)
+		assert.EqualError(t, err, "3:15: argument 1 of twice must be int, got bool")
+	})
+
+	t.Run("Missing returns", func(t *testing.T) {
+		err := check(t, `
+fn a(int n) int {
+	if (n > 0) {
+		return 1;
+	}
+}
+
+fn b(int n) int {
+	if (n > 0) {
+		return 1;
+	} else if (n < 0) {
+		return -1;
+	} else {
+		return 0;
+	}
+}
+
+fn c() int {
+	for (;;) {
+		for (;;) {
+			break;
+		}
+		return 1;
+	}
+}
+
+fn d() int {
+	for (;;) {
+		if (true) {
+			break;
+		}
+	}
+}
+
+fn e() {}
+
+fn g() int {
+	{
+		return 1;
+	}
+}
+
+fn h(int n) int {
+	while (true) {
+		if (n > 10) {
+			return n;
+		}
+		n++;
+	}
+}
+
+fn i() int {
+	while (true) {
+		break;
+	}
+}
+`, nil)
+		assert.EqualError(t, err, "2:1: a must return int on every path\n27:1: d must return int on every path\n52:1: i must return int on every path")
+
+		var diags diag.Diagnostics
+		assert.ErrorAs(t, err, &diags)
+		assert.Equal(t, diag.CodeMissingReturn, diags[0].Code)
+	})
+
+	t.Run("Void functions used as values", func(t *testing.T) {
+		err := check(t, `
+fn log(string msg) {}
+
+fn main() int {
+	log("hello");
+	var x = log("x");
+	return 1 + log("y");
+}
+`, nil)
+		assert.EqualError(t, err, "6:10: log does not return a value and cannot be used as one\n7:13: log does not return a value and cannot be used as one")
+	})
+
+	t.Run("Function values", func(t *testing.T) {
+		err := check(t, `
+fn apply(fn(int) int f, int v) int {
+	return f(v);
+}
+
+fn twice(fn(int) int f) fn(int) int {
+	return fn(int v) int { return f(f(v)); };
+}
+
+fn main() int {
+	var inc = fn(int n) int { return n + 1; };
+	return apply(twice(inc), 1);
+}
+`, nil)
+		assert.NoError(t, err)
+
+		err = check(t, `
+fn apply(fn(int) int f, int v) int {
+	return f(v);
+}
+
+fn main() bool {
+	var s = apply(fn(string s) int { return 1; }, 1);
+	var f = fn() {};
+	f(1);
+	return main == main;
+}
+`, nil)
+		assert.EqualError(t, err, "7:16: argument 1 of apply must be fn(int) int, got fn(string) int\n9:2: f expects 0 arguments, got 1\n10:9: operator == cannot be used with fn() bool and fn() bool")
+	})
+
+	t.Run("Lists", func(t *testing.T) {
+		err := check(t, `
+fn main() []string {
+	var names = ["a", "b"];
+	[][]int grid = [[], [1]];
+	names[0] = "c";
+	for (var name in names[1:]) {
+		names = append(names, name + "!");
+	}
+	return [];
+}
+`, nil)
+		assert.NoError(t, err)
+
+		err = check(t, `
+fn main() int {
+	var list = [1, 2.5];
+	list[true] = "a";
+	var sum = list[0:"b"];
+	list = append(list, 1.5);
+	return len(1) + len(list, list);
+}
+`, nil)
+		assert.EqualError(t, err, "3:17: list element must be int, got float\n"+
+			"4:7: list index must be int, got bool\n"+
+			"4:15: cannot assign string to an element of type int\n"+
+			"5:19: list index must be int, got string\n"+
+			"6:22: argument 2 of append must be int, got float\n"+
+			"7:13: argument of len must be a list, got int\n"+
+			"7:18: len expects 1 argument, got 2")
+	})
+
+	t.Run("Lists cannot be compared", func(t *testing.T) {
+		err := check(t, `fn f() bool { return [1] == [1]; }`, nil)
+		assert.EqualError(t, err, "1:22: operator == cannot be used with []int and []int")
+	})
+
+	t.Run("Ints are promoted to float", func(t *testing.T) {
+		err := check(t, `
+fn half(float x) float {
+	return x / 2;
+}
+
+fn main() float {
+	float f = 1;
+	var n = 3;
+	f = n;
+	[]float list = [n, 2];
+	list[0] = 4;
+	list = append(list, n);
+	return half(2) + f;
+}
+`, nil)
+		assert.NoError(t, err)
+
+		err = check(t, "fn f() int {\nfloat x = 2.5;\nint n = x;\nreturn int(x) + n;\n}", nil)
+		assert.EqualError(t, err, "3:9: type mismatch: expected int, got float")
+	})
+
+	t.Run("Conversions", func(t *testing.T) {
+		err := check(t, `fn f(float x) float { return float(int(x) / 2); }`, nil)
+		assert.NoError(t, err)
+
+		err = check(t, `fn f() int { return int("1") + int(1, 2); }`, nil)
+		assert.EqualError(t, err, "1:25: cannot convert string to int\n1:32: int expects 1 argument, got 2")
+	})
+
+	t.Run("Empty lists need a type", func(t *testing.T) {
+		err := check(t, `fn f() int { return len([]); }`, nil)
+		assert.EqualError(t, err, "1:25: cannot infer the type of an empty list")
+	})
+}
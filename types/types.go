@@ -1,10 +1,17 @@
 package types
 
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
 type Type interface {
 	isType()
 }
 
-//go:generate go run golang.org/x/tools/cmd/stringer -type=BasicType
+//go:generate go run golang.org/x/tools/cmd/stringer -type=BasicType -linecomment
 
 type BasicType int
 
@@ -14,8 +21,86 @@ const (
 	_ BasicType = iota
 
 	// No type. Used for void functions
-	Void
+	Void // void
+
+	Bool   // bool
+	Int    // int
+	Float  // float
+	String // string
+)
+
+// FuncType is the type of a function value, like fn(int, int) bool.
+// Function types are created by Func, which returns the same pointer for equal types
+// so that all types can be compared with ==.
+type FuncType struct {
+	Params []Type
+	// Return is Void for functions without a result.
+	Return Type
+}
+
+func (*FuncType) isType() {}
+
+func (t *FuncType) String() string {
+	params := make([]string, 0, len(t.Params))
+	for _, param := range t.Params {
+		params = append(params, fmt.Sprint(param))
+	}
+
+	s := "fn(" + strings.Join(params, ", ") + ")"
+	if t.Return != Void {
+		s += fmt.Sprintf(" %v", t.Return)
+	}
+
+	return s
+}
+
+var (
+	funcTypesMu sync.Mutex
+	// funcTypes holds the function types created so far by their string representation.
+	funcTypes = make(map[string]*FuncType)
+)
 
-	Bool
-	Int
+// Func returns the type of functions with the given parameter and return types.
+func Func(params []Type, ret Type) *FuncType {
+	t := &FuncType{Params: slices.Clone(params), Return: ret}
+	key := t.String()
+
+	funcTypesMu.Lock()
+	defer funcTypesMu.Unlock()
+
+	if existing, ok := funcTypes[key]; ok {
+		return existing
+	}
+
+	funcTypes[key] = t
+	return t
+}
+
+// ListType is the type of a list, like []int. Like function types, list types are created by List.
+type ListType struct {
+	Elem Type
+}
+
+func (*ListType) isType() {}
+
+func (t *ListType) String() string { return fmt.Sprintf("[]%v", t.Elem) }
+
+var (
+	listTypesMu sync.Mutex
+	// listTypes holds the list types created so far by their element type.
+	listTypes = make(map[Type]*ListType)
 )
+
+// List returns the type of lists holding elements of the given type.
+func List(elem Type) *ListType {
+	listTypesMu.Lock()
+	defer listTypesMu.Unlock()
+
+	if existing, ok := listTypes[elem]; ok {
+		return existing
+	}
+
+	t := &ListType{Elem: elem}
+	listTypes[elem] = t
+	return t
+}